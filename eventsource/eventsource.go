@@ -8,9 +8,9 @@ import (
 )
 
 type BaseEvent struct {
-	AggregateId string
-	Version     int
-	At          time.Time
+	AggregateId string    `json:"aggregateId"`
+	Version     int       `json:"version"`
+	At          time.Time `json:"at"`
 }
 
 func NewAggregateId() string {
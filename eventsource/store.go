@@ -0,0 +1,96 @@
+package eventsource
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Event is anything embedding a BaseEvent.
+type Event interface {
+	Base() BaseEvent
+}
+
+func (e BaseEvent) Base() BaseEvent {
+	return e
+}
+
+// InMemoryStore keeps the events of any number of aggregates, e.g. for a server hosting
+// many games. It's safe for concurrent use.
+type InMemoryStore struct {
+	mu     sync.Mutex
+	events map[string][]Event
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{events: make(map[string][]Event)}
+}
+
+// Append adds events to the end of their aggregates' logs. Each event's version must follow
+// on directly from the last one for its aggregate, or else nothing is appended.
+func (s *InMemoryStore) Append(events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Check every event before appending any of them.
+	latest := make(map[string]int)
+	for _, e := range events {
+		base := e.Base()
+		if _, ok := latest[base.AggregateId]; !ok {
+			latest[base.AggregateId] = len(s.events[base.AggregateId])
+		}
+
+		if base.Version != latest[base.AggregateId]+1 {
+			return fmt.Errorf("Version conflict for %s: expected version %d, got %d.", base.AggregateId, latest[base.AggregateId]+1, base.Version)
+		}
+		latest[base.AggregateId] = base.Version
+	}
+
+	for _, e := range events {
+		id := e.Base().AggregateId
+		s.events[id] = append(s.events[id], e)
+	}
+
+	return nil
+}
+
+// Load returns all the events for an aggregate, in order.
+func (s *InMemoryStore) Load(id string) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, ok := s.events[id]
+	if !ok {
+		return nil, fmt.Errorf("No events for aggregate %s.", id)
+	}
+
+	return append([]Event(nil), events...), nil
+}
+
+// ListAggregates returns the ids of every aggregate with events in the store, sorted.
+func (s *InMemoryStore) ListAggregates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.events))
+	for id := range s.events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// LatestVersion returns the version of an aggregate's last event, which the next event
+// appended must follow on from.
+func (s *InMemoryStore) LatestVersion(id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events, ok := s.events[id]
+	if !ok {
+		return 0, fmt.Errorf("No events for aggregate %s.", id)
+	}
+
+	return events[len(events)-1].Base().Version, nil
+}
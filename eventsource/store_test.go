@@ -0,0 +1,55 @@
+package eventsource
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	s := NewInMemoryStore()
+	now := time.Now()
+
+	err := s.Append(
+		BaseEvent{AggregateId: "b", Version: 1, At: now},
+		BaseEvent{AggregateId: "a", Version: 1, At: now},
+		BaseEvent{AggregateId: "b", Version: 2, At: now},
+	)
+	if err != nil {
+		t.Fatalf("Failed to append events: %s", err)
+	}
+
+	err = s.Append(BaseEvent{AggregateId: "b", Version: 3, At: now})
+	if err != nil {
+		t.Fatalf("Failed to append events: %s", err)
+	}
+
+	ids := s.ListAggregates()
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("Expected aggregates [a b] (found %v)", ids)
+	}
+
+	expected := map[string]int{"a": 1, "b": 3}
+	for id, version := range expected {
+		latest, err := s.LatestVersion(id)
+		if err != nil {
+			t.Errorf("Failed to get latest version of %s: %s", id, err)
+		} else if latest != version {
+			t.Errorf("Expected latest version %d for %s (found %d)", version, id, latest)
+		}
+	}
+
+	_, err = s.LatestVersion("c")
+	if err == nil {
+		t.Error("Failed to detect an unknown aggregate")
+	}
+
+	// Appending out of order is rejected, leaving the store unchanged.
+	err = s.Append(BaseEvent{AggregateId: "a", Version: 2, At: now}, BaseEvent{AggregateId: "a", Version: 2, At: now})
+	if err == nil {
+		t.Error("Failed to detect a version conflict")
+	}
+
+	if latest, _ := s.LatestVersion("a"); latest != 1 {
+		t.Errorf("A rejected append shouldn't change the latest version (found %d)", latest)
+	}
+}
@@ -0,0 +1,267 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"zephyri.co/mineswept/eventsource"
+)
+
+// ExportAnnotated writes out the game's whole history for analysis tools, in a format modelled
+// on SGF, which records go and other board games. The first node describes the game: its id,
+// size, mines and outcome. Each node after it is an event, in order, with when it happened.
+// It gives the game away, so it's not for players. ParseAnnotated reads it back.
+//
+//	(;GM[Mineswept]ID[...]SZ[5:5]AD[Moore]LY[...*.]...RE[Won]V[1]DT[2020-01-01T12:00:00Z]
+//	;EV[CellRevealed]V[2]DT[2020-01-01T12:00:01Z]CE[A1]IN[A1]RS[19]
+//	...)
+func (g *game) ExportAnnotated() string {
+	var out strings.Builder
+	started := g.events[0].(gameStartedEvent)
+
+	adjacency := "Moore"
+	if g.options.Adjacency == VonNeumann {
+		adjacency = "VonNeumann"
+	}
+
+	outcome := "Playing"
+	if g.isWon {
+		outcome = "Won"
+	} else if g.isEnded {
+		outcome = "Lost"
+	}
+
+	out.WriteString("(;GM[Mineswept]")
+	writeProperty(&out, "ID", g.id)
+	writeProperty(&out, "SZ", fmt.Sprintf("%d:%d", len(started.grid[0]), len(started.grid)))
+	writeProperty(&out, "AD", adjacency)
+	writeProperty(&out, "LY", mineRows(started.grid)...)
+	writeProperty(&out, "RE", outcome)
+	writeProperty(&out, "V", strconv.Itoa(started.Version))
+	writeProperty(&out, "DT", started.At.Format(time.RFC3339Nano))
+
+	for _, e := range g.events[1:] {
+		s := saveEvent(e)
+		out.WriteString("\n;")
+		writeProperty(&out, "EV", s.Type)
+		writeProperty(&out, "V", strconv.Itoa(s.Version))
+		writeProperty(&out, "DT", s.At.Format(time.RFC3339Nano))
+
+		cells := s.Cells
+		if s.Cell != "" {
+			cells = []CellName{s.Cell}
+		}
+		for _, cellName := range cells {
+			writeProperty(&out, "CE", string(cellName))
+		}
+
+		if s.Interaction != "" {
+			writeProperty(&out, "IN", string(s.Interaction))
+		}
+
+		if s.Type == "CellRevealed" || s.Type == "CellsRevealed" {
+			writeProperty(&out, "RS", strconv.Itoa(s.RemainingSafe))
+		}
+
+		if s.Cascaded > 0 {
+			writeProperty(&out, "CA", strconv.Itoa(s.Cascaded))
+		}
+
+		if s.Note != "" {
+			writeProperty(&out, "NT", s.Note)
+		}
+
+		if s.Source != "" {
+			writeProperty(&out, "SR", s.Source)
+		}
+	}
+	out.WriteString(")\n")
+
+	return out.String()
+}
+
+// writeProperty writes a property with each of its values, escaping any characters which would
+// otherwise end a value early.
+func writeProperty(out *strings.Builder, id string, values ...string) {
+	out.WriteString(id)
+	for _, v := range values {
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		v = strings.ReplaceAll(v, "]", `\]`)
+		out.WriteString("[" + v + "]")
+	}
+}
+
+// ParseAnnotated reads a record written by ExportAnnotated, replaying its events to get back
+// to the game it describes. The recorded outcome must match where the events lead.
+func ParseAnnotated(record string) (*game, error) {
+	nodes, err := parseNodes(record)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid record: %s", err)
+	}
+
+	root := nodes[0]
+	if firstValue(root["GM"]) != "Mineswept" {
+		return nil, fmt.Errorf("Invalid record: Not a Mineswept game.")
+	}
+
+	opts := Options{}
+	switch firstValue(root["AD"]) {
+	case "Moore", "":
+	case "VonNeumann":
+		opts.Adjacency = VonNeumann
+	default:
+		return nil, fmt.Errorf("Invalid record: Unknown adjacency '%s'.", firstValue(root["AD"]))
+	}
+
+	saved := make([]savedEvent, len(nodes))
+	saved[0] = savedEvent{Type: "GameStarted", Mines: root["LY"]}
+	for i, node := range nodes[1:] {
+		saved[i+1] = savedEvent{
+			Type:        firstValue(node["EV"]),
+			Cell:        CellName(firstValue(node["CE"])),
+			Interaction: CellName(firstValue(node["IN"])),
+			Note:        firstValue(node["NT"]),
+			Source:      firstValue(node["SR"]),
+		}
+
+		if node["RS"] != nil {
+			if saved[i+1].RemainingSafe, err = strconv.Atoi(firstValue(node["RS"])); err != nil {
+				return nil, fmt.Errorf("Invalid record: Node %d has an invalid RS: %s", i+2, err)
+			}
+		}
+
+		if node["CA"] != nil {
+			if saved[i+1].Cascaded, err = strconv.Atoi(firstValue(node["CA"])); err != nil {
+				return nil, fmt.Errorf("Invalid record: Node %d has an invalid CA: %s", i+2, err)
+			}
+		}
+
+		if saved[i+1].Type == "CellsRevealed" {
+			saved[i+1].Cell = ""
+			for _, cellName := range node["CE"] {
+				saved[i+1].Cells = append(saved[i+1].Cells, CellName(cellName))
+			}
+		}
+	}
+
+	for i, node := range nodes {
+		saved[i].BaseEvent, err = parseBaseEvent(node, firstValue(root["ID"]))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid record: Node %d %s", i+1, err)
+		}
+	}
+
+	events, err := loadEvents(saved, opts.Adjacency)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid record: %s", err)
+	}
+
+	g := &game{options: opts, rng: newRandom(0)}
+	if err := g.replay(events); err != nil {
+		return nil, fmt.Errorf("Invalid record: %s", err)
+	}
+
+	if size := fmt.Sprintf("%d:%d", len(g.grid[0]), len(g.grid)); firstValue(root["SZ"]) != size {
+		return nil, fmt.Errorf("Invalid record: The size is recorded as '%s', but the layout is %s.", firstValue(root["SZ"]), size)
+	}
+
+	outcome := "Playing"
+	if g.isWon {
+		outcome = "Won"
+	} else if g.isEnded {
+		outcome = "Lost"
+	}
+
+	if recorded := firstValue(root["RE"]); recorded != outcome {
+		return nil, fmt.Errorf("Invalid record: The outcome is recorded as '%s', but the events lead to '%s'.", recorded, outcome)
+	}
+
+	return g, nil
+}
+
+// parseBaseEvent reads the version and time of the event a node describes.
+func parseBaseEvent(node map[string][]string, id string) (eventsource.BaseEvent, error) {
+	base := eventsource.BaseEvent{AggregateId: id}
+
+	version, err := strconv.Atoi(firstValue(node["V"]))
+	if err != nil {
+		return base, fmt.Errorf("has an invalid V: %s", err)
+	}
+	base.Version = version
+
+	at, err := time.Parse(time.RFC3339Nano, firstValue(node["DT"]))
+	if err != nil {
+		return base, fmt.Errorf("has an invalid DT: %s", err)
+	}
+	base.At = at
+
+	return base, nil
+}
+
+// parseNodes splits a record into its nodes, each a map from property id to values.
+func parseNodes(record string) ([]map[string][]string, error) {
+	record = strings.TrimSpace(record)
+	if !strings.HasPrefix(record, "(") || !strings.HasSuffix(record, ")") {
+		return nil, fmt.Errorf("Must be wrapped in parentheses.")
+	}
+	record = record[1 : len(record)-1]
+
+	nodes := []map[string][]string{}
+	var id strings.Builder
+	lastId := ""
+	for i := 0; i < len(record); i++ {
+		switch c := record[i]; {
+		case c == ';':
+			nodes = append(nodes, map[string][]string{})
+			lastId = ""
+		case c == ' ' || c == '\n' || c == '\r' || c == '\t':
+		case c >= 'A' && c <= 'Z':
+			if len(nodes) == 0 {
+				return nil, fmt.Errorf("Property outside of a node.")
+			}
+			id.WriteByte(c)
+		case c == '[':
+			// Further values for the same property follow straight on, without its id.
+			if id.Len() > 0 {
+				lastId = id.String()
+				id.Reset()
+			} else if lastId == "" || record[i-1] != ']' {
+				return nil, fmt.Errorf("Value without a property.")
+			}
+
+			// Read up to the closing bracket, unescaping as we go.
+			var value strings.Builder
+			for i++; i < len(record) && record[i] != ']'; i++ {
+				if record[i] == '\\' && i+1 < len(record) {
+					i++
+				}
+				value.WriteByte(record[i])
+			}
+
+			if i == len(record) {
+				return nil, fmt.Errorf("Value is missing its closing bracket.")
+			}
+
+			nodes[len(nodes)-1][lastId] = append(nodes[len(nodes)-1][lastId], value.String())
+		default:
+			return nil, fmt.Errorf("Unexpected '%c'.", c)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("There are no nodes.")
+	}
+
+	return nodes, nil
+}
+
+// firstValue gives the first of a property's values, or nothing if it has none.
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
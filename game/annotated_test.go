@@ -0,0 +1,51 @@
+package game
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportAndParseAnnotated(t *testing.T) {
+	useFakeClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), time.Second)
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.FlagCell("B2")
+	g.AnnotateCell("A1", "50/50 [maybe]")
+	g.RevealCell("D1")
+
+	record := g.ExportAnnotated()
+	if !strings.Contains(record, "RE[Lost]") || !strings.Contains(record, `NT[50/50 [maybe\]]`) {
+		t.Errorf("Expected the record to include the outcome and the escaped note\n%s", record)
+	}
+
+	parsed, err := ParseAnnotated(record)
+	if err != nil {
+		t.Fatalf("Failed parsing annotated record: %s\n%s", err, record)
+	}
+
+	if len(parsed.events) != len(g.events) || !parsed.isEnded || parsed.RemainingSafeCells() == 0 {
+		t.Errorf("Expected the same %d events, ending in a loss (found %d)", len(g.events), len(parsed.events))
+	}
+
+	for i := range g.events {
+		expected, found := recordOf(g.events[i]), recordOf(parsed.events[i])
+		if expected.Type != found.Type || expected.Version != found.Version || !expected.At.Equal(found.At) || expected.Cell != found.Cell {
+			t.Errorf("Expected event %d to be %+v (found %+v)", i+1, expected, found)
+		}
+	}
+
+	if again := parsed.ExportAnnotated(); again != record {
+		t.Errorf("Expected exporting the parsed game to give the same record\nExpected:\n%s\nFound:\n%s", record, again)
+	}
+
+	// The outcome has to agree with the events.
+	if _, err := ParseAnnotated(strings.Replace(record, "RE[Lost]", "RE[Won]", 1)); err == nil {
+		t.Error("Expected an error parsing a record with the wrong outcome")
+	}
+
+	if _, err := ParseAnnotated("(;GM[Mineswept]LY[..*"); err == nil {
+		t.Error("Expected an error parsing a truncated record")
+	}
+}
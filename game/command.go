@@ -0,0 +1,54 @@
+package game
+
+// Command is a move which can be carried out by Dispatch, letting front-ends issue every kind
+// of move the same way regardless of how they reach the game.
+type Command interface {
+	execute(g *game) error
+}
+
+type RevealCommand struct {
+	Cell CellName
+}
+
+func (c RevealCommand) execute(g *game) error {
+	return g.RevealCell(c.Cell)
+}
+
+type FlagCommand struct {
+	Cell CellName
+}
+
+func (c FlagCommand) execute(g *game) error {
+	return g.FlagCell(c.Cell)
+}
+
+type ChordCommand struct {
+	Cell CellName
+}
+
+func (c ChordCommand) execute(g *game) error {
+	return g.ChordCell(c.Cell)
+}
+
+// UndoCommand takes back the last move. Since that removes events rather than adding any,
+// dispatching it gives no records back.
+type UndoCommand struct{}
+
+func (c UndoCommand) execute(g *game) error {
+	return g.UndoMove()
+}
+
+// Dispatch carries out a command, returning records of the events it generated.
+func Dispatch(g *game, cmd Command) ([]EventRecord, error) {
+	events, err := g.recordEvents(func() error { return cmd.execute(g) })
+	if err != nil {
+		return nil, err
+	}
+
+	records := []EventRecord{}
+	for _, e := range events {
+		records = append(records, recordOf(e))
+	}
+
+	return records, nil
+}
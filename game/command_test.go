@@ -0,0 +1,66 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestDispatch(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Revealing E3 cascades to its neighbors, all of which come back as records.
+	records, err := Dispatch(g, RevealCommand{Cell: "E3"})
+	if err != nil {
+		t.Fatalf("Failed to dispatch reveal of E3: %s", err)
+	}
+
+	expectedCells := []CellName{"E3", "D2", "E2", "D3", "D4", "E4", "C2", "C3", "C4"}
+	if len(records) != len(expectedCells) {
+		t.Fatalf("Expected %d records (found %d)", len(expectedCells), len(records))
+	}
+
+	revealed := make(map[CellName]bool)
+	for i, r := range records {
+		if r.Type != "CellRevealed" {
+			t.Errorf("Record %d should be a CellRevealed (is %s)", i, r.Type)
+		}
+		if r.AggregateId != g.id {
+			t.Errorf("Record %d has the wrong aggregate id %s", i, r.AggregateId)
+		}
+		if r.Version != i+2 {
+			t.Errorf("Record %d should have version %d (has %d)", i, i+2, r.Version)
+		}
+		revealed[r.Cell] = true
+	}
+
+	if records[0].Cell != "E3" {
+		t.Errorf("First record should be for the clicked cell E3 (is %s)", records[0].Cell)
+	}
+
+	for _, cellName := range expectedCells {
+		if !revealed[cellName] {
+			t.Errorf("Missing a record for cell %s", cellName)
+		}
+	}
+
+	// Errors come back without any records.
+	records, err = Dispatch(g, FlagCommand{Cell: "E3"})
+	if err == nil || records != nil {
+		t.Errorf("Expected an error and no records flagging a revealed cell (found %v, %v)", records, err)
+	}
+
+	// Undoing removes events rather than adding them.
+	records, err = Dispatch(g, UndoCommand{})
+	if err != nil {
+		t.Errorf("Failed to dispatch undo: %s", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected no records from undo (found %d)", len(records))
+	}
+	if len(g.events) != 1 {
+		t.Errorf("Expected undo to leave only the started event (found %d)", len(g.events))
+	}
+}
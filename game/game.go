@@ -1,7 +1,12 @@
 package game
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"reflect"
 	"regexp"
 	"time"
 
@@ -10,33 +15,191 @@ import (
 
 var validCellName = regexp.MustCompile("([A-z]+)([0-9]+)")
 
+// Common mistakes in cell names, for which we can suggest what was meant.
+var reversedCellName = regexp.MustCompile("^([0-9]+)([A-Za-z]+)$")
+var columnOnlyCellName = regexp.MustCompile("^[A-Za-z]+$")
+
+// Players sometimes type a separator between the column and row, e.g. A-1, A.1 or A 1.
+var separatedCellName = regexp.MustCompile("^([A-Za-z]+)[-. ]([0-9]+)$")
+
+// clock provides the timestamp for every new event. Tests may swap it out for a fake.
+var clock = time.Now
+
+// ErrCellFlagged is returned when trying to reveal a flagged cell. Flags protect cells from
+// being revealed by mistake, so the flag has to be removed first.
+var ErrCellFlagged = errors.New("Cell is flagged.")
+
+// ErrGameEnded is returned when trying to make a move once the game has been won or lost.
+var ErrGameEnded = errors.New("Game has already ended.")
+
+// ErrGameNotStarted is returned when trying to make a move in a game with no board yet, e.g.
+// one being replayed from events which don't start with the game starting.
+var ErrGameNotStarted = errors.New("Game hasn't started.")
+
+// ErrInternal is returned when a move fails because of a bug, rather than anything the player
+// did. The move is abandoned and the game left as it was before.
+var ErrInternal = errors.New("Internal error.")
+
 type Game interface {
 	IsComplete() bool
+	RevealCell(cellName CellName) error
+	FlagCell(cellName CellName) error
+	Snapshot() Snapshot
+	Records(since int) []EventRecord
 }
 
 // type AggregateId string
 
-type GameInfo struct {
-	Id   string
-	Name string
+// Options tweaks the rules a game is played under. The zero value gives a normal game.
+type Options struct {
+	// EditorMode allows puzzle designers to alter the board (e.g., DefuseCell) before play starts.
+	EditorMode bool
+
+	// StrictFlags forbids placing more flags than there are mines.
+	StrictFlags bool
+
+	// CompactCascades records a reveal and all the cells it opens up automatically as a single
+	// event, rather than one event per cell. Replaying either gives the same grid.
+	CompactCascades bool
+
+	// SpreadMines avoids placing mines next to each other where possible, so that they
+	// don't clump together into boring boards.
+	SpreadMines bool
+
+	// MaxIdle is how long a game can go without a move before it expires, e.g. so a server
+	// can clear out abandoned games. Zero means it never expires.
+	MaxIdle time.Duration
+
+	// Adjacency decides which cells count as neighbors, for both mine counts and cascades.
+	Adjacency Adjacency
+
+	// MaxCascadeEvents limits how many events a single cascade can add, so that opening up a
+	// huge empty region doesn't flood the log. Past the limit, the rest of the region is
+	// recorded as one event revealing many cells. Replays still reveal the same cells, but
+	// lose the order and timing of the individual reveals. Zero means no limit.
+	MaxCascadeEvents int
+
+	// MaxEvents limits how long the event log can grow. Past the limit, the log is compacted
+	// into a fresh start followed by the events needed to get back to where the game is, and
+	// earlier moves can no longer be undone. It can't be compacted below one event per flag or
+	// note, and the log of a game which has ended is left as it is. Zero means no limit.
+	MaxEvents int
+
+	// WinCondition decides what the player has to do to win.
+	WinCondition WinCondition
+
+	// Seed decides where the mines go, along with any other chance in the game, so the same seed
+	// always gives the same game. Zero picks a seed at random, which the game then reports as
+	// its Seed.
+	Seed int64
+}
+
+// WinCondition is a way of winning a game.
+type WinCondition int
+
+const (
+	// RevealAllSafe wins once every cell without a mine has been revealed. It's the default.
+	RevealAllSafe WinCondition = iota
+
+	// FlagAllMines wins once every mine is flagged, and no other cell is.
+	FlagAllMines
+)
+
+// Adjacency is a way of deciding which cells neighbor each other.
+type Adjacency int
+
+const (
+	// Moore adjacency counts all eight surrounding cells, diagonals included. It's the default.
+	Moore Adjacency = iota
+
+	// VonNeumann adjacency only counts the four cells directly above, below, left and right.
+	VonNeumann
+)
+
+// Source is who or what made a move, so that analytics can tell the player's own play apart
+// from the help they had.
+type Source int
+
+const (
+	// SourceUser moves were made by the player. It's the default.
+	SourceUser Source = iota
+
+	// SourceAI moves were made for the player, e.g. by AutoPlayStep or a hint.
+	SourceAI
+
+	// SourceCascade reveals followed on automatically from revealing an empty cell.
+	SourceCascade
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceAI:
+		return "AI"
+	case SourceCascade:
+		return "Cascade"
+	}
+
+	return "User"
 }
 
-// ListSavedGames will look in a hidden directory in the user's home for any previously saved games.
-func ListSavedGames() []GameInfo {
-	return []GameInfo{{"asdf", "First Game"}}
+// parseSource reads a source written out by Source.String.
+func parseSource(s string) (Source, error) {
+	for _, source := range []Source{SourceUser, SourceAI, SourceCascade} {
+		if s == source.String() {
+			return source, nil
+		}
+	}
+
+	return SourceUser, fmt.Errorf("Unknown source '%s'.", s)
 }
 
 type game struct {
 	id                         string
 	version                    int
 	name                       string
+	options                    Options
 	grid                       [][]cell
 	cellCount                  int
+	mineCount                  int
 	revealedOrFlaggedCellCount int
+	revealedSafeCount          int
+	userRevealedCount          int
+	cascadeRevealedCount       int
+	flagCount                  int
 	isEnded                    bool
+	isWon                      bool
 	createdAt                  time.Time
 	updatedAt                  time.Time
 	events                     []event
+	rng                        *rand.Rand
+
+	// moves holds the index in events at which each of the player's moves began, so that
+	// a move and everything which followed from it can be undone together.
+	moves []int
+
+	// undone holds the events of each move which was undone, the latest last, so that they
+	// can be redone.
+	undone [][]event
+
+	// source is who's making the current move, for the events it adds.
+	source Source
+
+	// added collects the events appended while recording, since compaction can rewrite the
+	// log part way through a move. It's nil when nothing is recording.
+	added *[]event
+
+	spectators []chan EventRecord
+	onWin      []func()
+	onLose     []func(detonated CellName)
+	onCascade  []func(revealed CellName)
+
+	// Each cell with no adjacent mines belongs to an open region, which is revealed all at
+	// once. regionIds holds the index in regions for each cell, or -1 for numbered cells.
+	regionIds [][]int
+	regions   [][]coordinate
+
+	// notes holds the player's annotations on cells, which have no effect on play.
+	notes map[coordinate]string
 }
 
 type CellName string
@@ -49,42 +212,248 @@ func (c coordinate) String() string {
 
 // NewGame will create a new game with a grid initialized to the desired size and mine count.
 func NewGame(width, height, mineCount int) (*game, error) {
+	return NewGameWithOptions(width, height, mineCount, Options{})
+}
+
+// NewGameWithOptions is like NewGame, but plays by the rules given in opts.
+func NewGameWithOptions(width, height, mineCount int, opts Options) (*game, error) {
+	// Settle on a seed now if it's left to chance, so that it can be shared afterwards.
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
 	// Initialize a valid grid if possible, else return an error.
-	grid, err := generateGrid(width, height, mineCount)
+	rng := newRandom(opts.Seed)
+	grid, err := generateGrid(width, height, mineCount, opts, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	return startGame(grid, opts, rng), nil
+}
+
+// NewGameWithDensity is like NewGame, but with the mine count given as a fraction of the cells,
+// e.g. 0.15 for a board which is 15% mines.
+func NewGameWithDensity(width, height int, density float64) (*game, error) {
+	return NewGame(width, height, int(math.Round(density*float64(width*height))))
+}
+
+// SymmetryAxis is a line which a board's mines can be mirrored across.
+type SymmetryAxis int
+
+const (
+	// HorizontalSymmetry mirrors the top half of the board onto the bottom half.
+	HorizontalSymmetry SymmetryAxis = iota
+
+	// VerticalSymmetry mirrors the left half of the board onto the right half.
+	VerticalSymmetry
+
+	// DiagonalSymmetry mirrors the board across its top-left to bottom-right diagonal, so is
+	// only possible on square boards.
+	DiagonalSymmetry
+)
+
+// NewSymmetricGame is like NewGame, but with the mines mirrored across the given axis, for
+// puzzles which look neat as well as play well. Mines on the axis itself have no twin, so an
+// odd mine count needs a board with cells on the axis (e.g., an odd width for VerticalSymmetry).
+// Like NewGameWithOptions, it plays by the rules given in opts, but for SpreadMines, and the same
+// seed and axis give the same board.
+func NewSymmetricGame(width, height, mineCount int, axis SymmetryAxis, opts Options) (*game, error) {
+	if err := validateGridSize(width, height, mineCount); err != nil {
+		return nil, err
+	}
+
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	rng := newRandom(opts.Seed)
+	mineCoords, err := chooseSymmetricMinePlacements(width, height, mineCount, axis, rng)
 	if err != nil {
 		return nil, err
 	}
 
+	return startGame(layoutGrid(width, height, mineCoords, opts.Adjacency), opts, rng), nil
+}
+
+// NewGameFromLayout will create a new game with mines placed in exactly the given cells,
+// rather than at random.
+func NewGameFromLayout(mines []CellName, width, height int) (*game, error) {
+	if err := validateGridSize(width, height, len(mines)); err != nil {
+		return nil, err
+	}
+
+	mineCoords := make([]coordinate, 0, len(mines))
+	placed := make(map[coordinate]bool)
+	for _, cellName := range mines {
+		coord, err := cellNameToCoordinate(cellName)
+		if err != nil {
+			return nil, err
+		}
+
+		if coord[0] < 0 || coord[0] >= width || coord[1] < 0 || coord[1] >= height {
+			return nil, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+		}
+
+		if placed[coord] {
+			return nil, fmt.Errorf("Cell %s is mined more than once.", cellName)
+		}
+
+		placed[coord] = true
+		mineCoords = append(mineCoords, coord)
+	}
+
+	return startGame(layoutGrid(width, height, mineCoords, Moore), Options{}, newRandom(0)), nil
+}
+
+// newRandom makes a source of chance for a game. Each game has its own, so that games running
+// at the same time don't disturb each other's sequences. A seed of zero picks one at random.
+func newRandom(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return rand.New(rand.NewSource(seed))
+}
+
+// Seed is the seed the game's board was generated from, which can be passed in Options to the
+// same constructor to play the same board again. It's zero for games whose mines were placed
+// by hand, e.g. from a layout.
+func (g *game) Seed() int64 {
+	return g.options.Seed
+}
+
+func startGame(grid [][]cell, opts Options, rng *rand.Rand) *game {
 	// Make the initial Game model.
-	g := game{}
+	g := game{options: opts, rng: rng}
 
 	// Append the first event with the complete initial state.
 	e := gameStartedEvent{
 		BaseEvent: eventsource.BaseEvent{
 			AggregateId: eventsource.NewAggregateId(),
 			Version:     1,
-			At:          time.Now(),
+			At:          clock(),
 		},
 		grid: grid,
 	}
 	e.applyTo(&g)
 	g.events = append(g.events, e)
 
-	return &g, nil
+	return &g
 }
 
 func (g *game) onGameStarted(e gameStartedEvent) []event {
+	// Nothing can be played on an invalid grid, so don't start. Replays check for this
+	// before applying the event, so it should never happen.
+	if validateGrid(e.grid) != nil {
+		return []event{}
+	}
+
 	g.id = e.AggregateId
 	g.version = e.Version
 	g.createdAt = e.At
 	g.updatedAt = e.At
-	g.grid = e.grid
+
+	// Play mutates the grid, so take a copy to leave the event as it was for any replay.
+	g.grid = make([][]cell, len(e.grid))
+	for y := range e.grid {
+		g.grid[y] = append([]cell(nil), e.grid[y]...)
+	}
+
 	g.cellCount = len(g.grid) * len(g.grid[0])
+	g.revealedOrFlaggedCellCount = 0
+	g.revealedSafeCount = 0
+	g.userRevealedCount = 0
+	g.cascadeRevealedCount = 0
+	g.flagCount = 0
+	g.isEnded = false
+	g.isWon = false
+	g.mineCount = 0
+	g.forEachCell(func(_ coordinate, target *cell) {
+		if target.isMined {
+			g.mineCount++
+		}
+	})
+	g.regionIds, g.regions = openRegions(g.grid, g.options.Adjacency)
+	g.notes = map[coordinate]string{}
 	return []event{}
 }
 
-// RevealCell makes a cell visible. If it's mined, you blow up!
-func (g *game) RevealCell(cellName CellName) error {
+// DefuseCell removes the mine from a cell, updating its neighbors' counts. It's meant for
+// puzzle editing, so it's only allowed in editor mode and before any cell is revealed.
+func (g *game) DefuseCell(cellName CellName) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	if !g.options.EditorMode {
+		return fmt.Errorf("Cells can only be defused in editor mode.")
+	}
+
+	if g.revealedOrFlaggedCellCount > 0 {
+		return fmt.Errorf("Cells can only be defused before play begins.")
+	}
+
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	if !g.grid[coord[1]][coord[0]].isMined {
+		return fmt.Errorf("Cell %s is not mined.", cellName)
+	}
+
+	defused := cellDefusedEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+		CellCoord: coord,
+	}
+	g.moves = append(g.moves, len(g.events))
+	defused.applyTo(g)
+	g.appendEvents(defused)
+
+	return nil
+}
+
+func (g *game) onCellDefused(e cellDefusedEvent) {
+	target := &g.grid[e.CellCoord[1]][e.CellCoord[0]]
+	target.isMined = false
+	target.adjacentMines = 0
+	g.mineCount--
+
+	// The defused cell now needs its own count, and its safe neighbors each lose one.
+	for _, n := range g.neighbors(e.CellCoord) {
+		neighbor := &g.grid[n[1]][n[0]]
+		if neighbor.isMined {
+			target.adjacentMines++
+		} else {
+			neighbor.adjacentMines--
+		}
+	}
+	g.regionIds, g.regions = openRegions(g.grid, g.options.Adjacency)
+
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+// RevealCell makes a cell visible. If it's mined, you blow up! Revealing a number whose mines
+// are all flagged chords it instead.
+func (g *game) RevealCell(cellName CellName) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
 	// Check that this is a valid move before generating an event.
 	coord, err := cellNameToCoordinate(cellName)
 	if err != nil {
@@ -95,21 +464,142 @@ func (g *game) RevealCell(cellName CellName) error {
 		return fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
 	}
 
-	if g.grid[coord[1]][coord[0]].isRevealed {
+	if g.isEnded {
+		return ErrGameEnded
+	}
+
+	// The board may already be cleared without the win having been recorded, e.g. in a log
+	// from elsewhere. Win it now, rather than let a mine be stepped on after the fact.
+	if won := g.winGameIfLastCell(coord); won != nil {
+		g.appendEvents(won)
+		return ErrGameEnded
+	}
+
+	target := g.grid[coord[1]][coord[0]]
+	if target.isRevealed {
+		// Clicking a number whose mines are all flagged is taken as a chord, as in most clients,
+		// so long as there's something left for it to open.
+		if target.adjacentMines > 0 && g.adjacentFlagCount(coord) == target.adjacentMines && g.hasUnrevealedNeighbor(coord) {
+			g.moves = append(g.moves, len(g.events))
+			g.chord(coord, cellName)
+			return nil
+		}
+
 		return fmt.Errorf("Cell %s already revealed", cellName)
 	}
 
+	if target.isFlagged {
+		return fmt.Errorf("%w Unflag %s before revealing it.", ErrCellFlagged, cellName)
+	}
+
+	g.moves = append(g.moves, len(g.events))
+	g.reveal(coord, cellName)
+
+	return nil
+}
+
+// RevealIndex is like RevealCell, but picks the cell by its position counting along each row
+// in turn from 0 at the top-left, for clients which find that simpler than cell names.
+func (g *game) RevealIndex(i int) error {
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	if i < 0 || i >= g.cellCount {
+		return fmt.Errorf("Invalid cell index %d. Must be between 0 and %d.", i, g.cellCount-1)
+	}
+
+	width := len(g.grid[0])
+	return g.RevealCell(coordinateToCellName(coordinate{i % width, i / width}))
+}
+
+// Outcome is how a move left the game.
+type Outcome int
+
+const (
+	// Continue means the game is still being played.
+	Continue Outcome = iota
+
+	// Won means the move revealed the last safe cell.
+	Won
+
+	// Lost means the move stepped on a mine.
+	Lost
+)
+
+// RevealCellOutcome is like RevealCell, but also says whether the reveal ended the game, so
+// clients don't need to check separately after every move.
+func (g *game) RevealCellOutcome(cellName CellName) (Outcome, error) {
+	if err := g.RevealCell(cellName); err != nil {
+		return Continue, err
+	}
+
+	if !g.isEnded {
+		return Continue, nil
+	} else if g.isWon {
+		return Won, nil
+	}
+
+	return Lost, nil
+}
+
+// RevealIdempotent is like RevealCell, but revealing a cell which is already revealed quietly
+// succeeds without doing anything. This suits clients which may retry a request.
+func (g *game) RevealIdempotent(cellName CellName) error {
+	coord, err := cellNameToCoordinate(cellName)
+	if err == nil && containsCoordinate(coord, g.grid) && g.grid[coord[1]][coord[0]].isRevealed {
+		return nil
+	}
+
+	return g.RevealCell(cellName)
+}
+
+// RevealCellResult is like RevealCell, but also returns every cell the reveal uncovered, in
+// order: the cell itself, then any which opened up automatically. If it was mined, the rest
+// of the board is revealed too, but those cells aren't listed.
+func (g *game) RevealCellResult(cellName CellName) ([]CellName, error) {
+	events, err := g.recordEvents(func() error { return g.RevealCell(cellName) })
+	if err != nil {
+		return nil, err
+	}
+
+	revealed := []CellName{}
+	for _, e := range events {
+		switch v := e.(type) {
+		case cellRevealedEvent:
+			revealed = append(revealed, coordinateToCellName(v.CellCoord))
+		case cellsRevealedEvent:
+			for _, c := range v.CellCoords {
+				revealed = append(revealed, coordinateToCellName(c))
+			}
+		}
+	}
+
+	return revealed, nil
+}
+
+// reveal uncovers an already validated coordinate, along with whatever follows from it. The
+// interaction is the cell the player actually clicked.
+func (g *game) reveal(coord coordinate, interaction CellName) {
+	if g.options.CompactCascades {
+		g.revealCompacted(coord, interaction)
+		return
+	}
+
 	// Generate and apply a simple cell reveal event.
 	revealed := cellRevealedEvent{
 		BaseEvent: eventsource.BaseEvent{
 			AggregateId: g.id,
 			Version:     g.version + 1,
-			At:          time.Now(),
+			At:          clock(),
 		},
-		InteractionCellName: cellName,
+		InteractionCellName: interaction,
 		CellCoord:           coord,
+		RemainingSafe:       g.remainingSafeAfter(coord),
+		Source:              g.source,
 	}
 	revealed.applyTo(g)
+	g.appendEvents(revealed)
 
 	// With that cell now revealed, generate and apply additional events if we've stepped
 	// on a mine (lost), correctly played the last cell (won), or need to automatically
@@ -118,135 +608,1328 @@ func (g *game) RevealCell(cellName CellName) error {
 	// Each called method will generate and apply the events themselves, returning them so
 	// we can persist events as desired.
 	if lost := g.loseGameIfMined(coord); lost != nil {
-		g.events = append(g.events, lost)
-		return nil
+		g.appendEvents(lost)
+		return
 	}
 
 	if revealedNeighbors := g.revealNeighborsIfNoAdjacentMines(coord, revealed); len(revealedNeighbors) > 0 {
-		g.events = append(g.events, revealedNeighbors...)
+		g.appendEvents(revealedNeighbors...)
 	}
 
 	if won := g.winGameIfLastCell(coord); won != nil {
-		g.events = append(g.events, won)
+		g.appendEvents(won)
 
 	}
-
-	return nil
+	g.winGameIfCleared()
 }
 
-func (g *game) onCellRevealed(e cellRevealedEvent) {
-	target := &g.grid[e.CellCoord[1]][e.CellCoord[0]]
-	target.isRevealed = true
-	g.revealedOrFlaggedCellCount++
-	g.version = e.Version
-	g.updatedAt = e.At
-}
+// ChordCell reveals all unflagged neighbors of a revealed number, once the player has placed
+// as many flags around it as it has adjacent mines. A misplaced flag means you blow up!
+func (g *game) ChordCell(cellName CellName) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
 
-func (g *game) onGameLost(e gameLostEvent) {
-	// Mark game as ended and reveal all cells.
-	g.isEnded = true
-	g.version = e.Version
-	g.updatedAt = e.At
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
 
-	for y := 0; y < len(g.grid); y++ {
-		for x := 0; x < len(g.grid[y]); x++ {
-			if !g.grid[y][x].isRevealed && !g.grid[y][x].isFlagged {
-				g.revealedOrFlaggedCellCount++
-			}
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return err
+	}
 
-			g.grid[y][x].isRevealed = true
-		}
+	if !containsCoordinate(coord, g.grid) {
+		return fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
 	}
-}
 
-func (g *game) onGameWon(e gameWonEvent) {
-	// Mark game as ended.
-	g.isEnded = true
-	g.version = e.Version
-	g.updatedAt = e.At
-}
+	if g.isEnded {
+		return ErrGameEnded
+	}
 
-func (g *game) loseGameIfMined(coord coordinate) event {
 	target := g.grid[coord[1]][coord[0]]
+	if !target.isRevealed {
+		return fmt.Errorf("Cell %s must be revealed before chording", cellName)
+	}
 
-	if !target.isMined || !target.isRevealed {
-		return nil
+	if flagged := g.adjacentFlagCount(coord); flagged != target.adjacentMines {
+		return fmt.Errorf("Cell %s has %d adjacent mines but %d flagged neighbors", cellName, target.adjacentMines, flagged)
 	}
 
-	e := gameLostEvent{
-		BaseEvent: eventsource.BaseEvent{
-			AggregateId: g.id,
-			Version:     g.version + 1,
-			At:          time.Now(),
-		},
+	if !g.hasUnrevealedNeighbor(coord) {
+		return fmt.Errorf("Cell %s has no unrevealed neighbors to chord", cellName)
 	}
-	e.applyTo(g)
 
-	return e
+	g.moves = append(g.moves, len(g.events))
+	g.chord(coord, cellName)
+
+	return nil
 }
 
-func (g *game) winGameIfLastCell(coord coordinate) event {
-	if g.cellCount != g.revealedOrFlaggedCellCount {
-		return nil
+// RevealThenChord reveals a cell and, if it turns out to be a number whose mines are all
+// flagged already, chords it straight away.
+func (g *game) RevealThenChord(cellName CellName) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	err = g.RevealCell(cellName)
+	if err != nil || g.isEnded {
+		return err
 	}
 
-	e := gameWonEvent{
-		BaseEvent: eventsource.BaseEvent{
-			AggregateId: g.id,
-			Version:     g.version + 1,
-			At:          time.Now(),
-		},
+	coord, _ := cellNameToCoordinate(cellName)
+	target := g.grid[coord[1]][coord[0]]
+	if target.adjacentMines > 0 && g.adjacentFlagCount(coord) == target.adjacentMines {
+		g.chord(coord, cellName)
 	}
-	e.applyTo(g)
 
-	return e
+	return nil
 }
 
-func (g *game) revealNeighborsIfNoAdjacentMines(coord coordinate, originalEvent cellRevealedEvent) []event {
-	events := []event{}
+// neighbors lists the cells next to coord, by the game's rules of adjacency.
+func (g *game) neighbors(coord coordinate) []coordinate {
+	return getNeighbors(coord, len(g.grid[0]), len(g.grid), g.options.Adjacency)
+}
 
-	// If there are adjacent mines, do nothing.
-	if g.grid[coord[1]][coord[0]].adjacentMines > 0 {
-		return events
+// hasUnrevealedNeighbor says whether a chord on coord would open anything.
+func (g *game) hasUnrevealedNeighbor(coord coordinate) bool {
+	for _, n := range g.neighbors(coord) {
+		if neighbor := g.grid[n[1]][n[0]]; !neighbor.isRevealed && !neighbor.isFlagged {
+			return true
+		}
 	}
 
-	// If there are no adjacent mines, reveal neighboring cells. Repeat for any
-	// neighbor with no adjacent mines (breadth-first traversal of the graph).
-	//
-	// For each new cell which needs to be revealed, apply and emit an event.
-	queue := getNeighbors(coord, len(g.grid[0]), len(g.grid))
-	for i := 0; i < len(queue); i++ {
-		neighbor := &g.grid[queue[i][1]][queue[i][0]]
-
-		if !neighbor.isRevealed && !neighbor.isMined {
-			revealed := cellRevealedEvent{
-				BaseEvent: eventsource.BaseEvent{
-					AggregateId: g.id,
-					Version:     g.version + 1,
-					At:          time.Now(),
-				},
-				InteractionCellName: originalEvent.InteractionCellName,
-				CellCoord:           queue[i],
-			}
-			revealed.applyTo(g)
-			events = append(events, revealed)
+	return false
+}
 
-			// If this newly revealed cell also has no adjacent mines, keep going!
-			if neighbor.adjacentMines == 0 {
-				queue = append(queue, getNeighbors(queue[i], len(g.grid[0]), len(g.grid))...)
-			}
+func (g *game) adjacentFlagCount(coord coordinate) int {
+	flagged := 0
+	for _, n := range g.neighbors(coord) {
+		if g.grid[n[1]][n[0]].isFlagged {
+			flagged++
 		}
 	}
 
-	return events
+	return flagged
 }
 
-func (g *game) FlagCell() {}
+func (g *game) chord(coord coordinate, interaction CellName) {
+	for _, n := range g.neighbors(coord) {
+		if g.isEnded {
+			return
+		}
 
-func (g *game) UndoMove() {}
+		if neighbor := g.grid[n[1]][n[0]]; !neighbor.isRevealed && !neighbor.isFlagged {
+			g.reveal(n, interaction)
+		}
+	}
+}
 
+// revealCompacted is like reveal, but records the cell and its cascade as one event.
+func (g *game) revealCompacted(coord coordinate, interaction CellName) {
+	coords := []coordinate{coord}
+	if !g.grid[coord[1]][coord[0]].isMined {
+		coords = append(coords, g.cascadeFrom(coord)...)
+	}
+
+	revealed := cellsRevealedEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+		InteractionCellName: interaction,
+		CellCoords:          coords,
+		RemainingSafe:       g.remainingSafeAfter(coords...),
+		Cascaded:            len(coords) - 1,
+		Source:              g.source,
+	}
+	revealed.applyTo(g)
+	g.appendEvents(revealed)
+
+	if lost := g.loseGameIfMined(coord); lost != nil {
+		g.appendEvents(lost)
+		return
+	}
+
+	if won := g.winGameIfLastCell(coord); won != nil {
+		g.appendEvents(won)
+	}
+	g.winGameIfCleared()
+}
+
+func (g *game) onCellRevealed(e cellRevealedEvent) {
+	g.markRevealed(e.CellCoord)
+	if e.ByCascade {
+		g.cascadeRevealedCount++
+	} else {
+		g.userRevealedCount++
+	}
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+func (g *game) onCellsRevealed(e cellsRevealedEvent) {
+	for _, c := range e.CellCoords {
+		g.markRevealed(c)
+	}
+	g.cascadeRevealedCount += e.Cascaded
+	g.userRevealedCount += len(e.CellCoords) - e.Cascaded
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+func (g *game) markRevealed(coord coordinate) {
+	target := &g.grid[coord[1]][coord[0]]
+	target.isRevealed = true
+	g.revealedOrFlaggedCellCount++
+	if !target.isMined {
+		g.revealedSafeCount++
+	}
+}
+
+func (g *game) onGameLost(e gameLostEvent) {
+	// Mark game as ended and reveal all cells.
+	g.isEnded = true
+	g.version = e.Version
+	g.updatedAt = e.At
+
+	g.forEachCell(func(_ coordinate, target *cell) {
+		if !target.isRevealed && !target.isFlagged {
+			g.revealedOrFlaggedCellCount++
+		}
+
+		target.isRevealed = true
+	})
+}
+
+func (g *game) onGameWon(e gameWonEvent) {
+	// Mark game as ended.
+	g.isEnded = true
+	g.isWon = true
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+func (g *game) loseGameIfMined(coord coordinate) event {
+	target := g.grid[coord[1]][coord[0]]
+
+	if !target.isMined || !target.isRevealed {
+		return nil
+	}
+
+	e := gameLostEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+		DetonatedCoord: coord,
+	}
+	e.applyTo(g)
+
+	return e
+}
+
+func (g *game) winGameIfLastCell(coord coordinate) event {
+	if g.isEnded || !g.hasMetWinCondition() {
+		return nil
+	}
+
+	e := gameWonEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+	}
+	e.applyTo(g)
+
+	return e
+}
+
+// winGameIfCleared is a safety net for the win check, which goes by counts kept up as cells are
+// revealed. It looks over the grid itself, and if every safe cell is revealed but the game still
+// hasn't been won, wins it, with a warning since the counts must be wrong.
+func (g *game) winGameIfCleared() {
+	if g.isEnded || g.options.WinCondition == FlagAllMines {
+		return
+	}
+
+	cleared := true
+	g.forEachCell(func(_ coordinate, target *cell) {
+		cleared = cleared && (target.isMined || target.isRevealed)
+	})
+	if !cleared {
+		return
+	}
+
+	log.Printf("Warning: Every safe cell in game %s is revealed, but it wasn't won. Winning it now.", g.id)
+	won := gameWonEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+	}
+	won.applyTo(g)
+	g.appendEvents(won)
+}
+
+// hasMetWinCondition checks whether the player has done what the game's win condition asks.
+func (g *game) hasMetWinCondition() bool {
+	if g.options.WinCondition != FlagAllMines {
+		return g.RemainingSafeCells() == 0
+	}
+
+	// Every flag has to be on a mine, so flagging everything doesn't win.
+	if g.flagCount != g.mineCount {
+		return false
+	}
+
+	flaggedMines := 0
+	g.forEachCell(func(_ coordinate, target *cell) {
+		if target.isMined && target.isFlagged {
+			flaggedMines++
+		}
+	})
+
+	return flaggedMines == g.mineCount
+}
+
+// remainingSafeAfter works out how many safe cells will be left to reveal once the given
+// cells have been.
+func (g *game) remainingSafeAfter(coords ...coordinate) int {
+	remaining := g.RemainingSafeCells()
+	for _, c := range coords {
+		if target := g.grid[c[1]][c[0]]; !target.isMined && !target.isRevealed {
+			remaining--
+		}
+	}
+
+	return remaining
+}
+
+func (g *game) revealNeighborsIfNoAdjacentMines(coord coordinate, originalEvent cellRevealedEvent) []event {
+	events := []event{}
+
+	cascade := g.cascadeFrom(coord)
+
+	// Keep the last event back for everything left over, if there are too many.
+	var rest []coordinate
+	if max := g.options.MaxCascadeEvents; max > 0 && len(cascade) > max {
+		cascade, rest = cascade[:max-1], cascade[max-1:]
+	}
+
+	// For each new cell which needs to be revealed, apply and emit an event.
+	for _, c := range cascade {
+		revealed := cellRevealedEvent{
+			BaseEvent: eventsource.BaseEvent{
+				AggregateId: g.id,
+				Version:     g.version + 1,
+				At:          clock(),
+			},
+			InteractionCellName: originalEvent.InteractionCellName,
+			CellCoord:           c,
+			RemainingSafe:       g.remainingSafeAfter(c),
+			ByCascade:           true,
+			Source:              SourceCascade,
+		}
+		revealed.applyTo(g)
+		events = append(events, revealed)
+	}
+
+	if len(rest) > 0 {
+		revealed := cellsRevealedEvent{
+			BaseEvent: eventsource.BaseEvent{
+				AggregateId: g.id,
+				Version:     g.version + 1,
+				At:          clock(),
+			},
+			InteractionCellName: originalEvent.InteractionCellName,
+			CellCoords:          rest,
+			RemainingSafe:       g.remainingSafeAfter(rest...),
+			Cascaded:            len(rest),
+			Source:              SourceCascade,
+		}
+		revealed.applyTo(g)
+		events = append(events, revealed)
+	}
+
+	return events
+}
+
+// cascadeFrom lists the cells which should be revealed automatically after revealing the
+// given one. Nothing is changed.
+func (g *game) cascadeFrom(coord coordinate) []coordinate {
+	cascade := []coordinate{}
+
+	// If there are adjacent mines, do nothing.
+	id := g.regionIds[coord[1]][coord[0]]
+	if id < 0 {
+		return cascade
+	}
+
+	// Flags are barriers which the cascade doesn't pass, so with any in the region it has to
+	// be searched again.
+	for _, c := range g.regions[id] {
+		if g.grid[c[1]][c[0]].isFlagged {
+			return floodFrom(g.grid, coord, g.options.Adjacency)
+		}
+	}
+
+	// Otherwise the whole open region the cell belongs to is revealed, which was worked
+	// out when the game started.
+	for _, c := range g.regions[id] {
+		if c != coord && !g.grid[c[1]][c[0]].isRevealed {
+			cascade = append(cascade, c)
+		}
+	}
+
+	return cascade
+}
+
+// LargestOpenRegion gives how many cells the biggest cascade on the board would reveal: the
+// largest connected region of cells with no adjacent mines, plus the numbers bordering it. It's
+// a measure of how interesting the board is, and looks at the whole board, revealed or not.
+func (g *game) LargestOpenRegion() int {
+	largest := 0
+	for _, region := range g.regions {
+		if len(region) > largest {
+			largest = len(region)
+		}
+	}
+
+	return largest
+}
+
+// RemainingSafeCells counts the cells without mines which the player has yet to reveal.
+// The game is won once this reaches zero.
+func (g *game) RemainingSafeCells() int {
+	return (g.cellCount - g.mineCount) - g.revealedSafeCount
+}
+
+// BoardStats summarizes the progress of a game, e.g. for a stats panel.
+type BoardStats struct {
+	Revealed      int
+	Flagged       int
+	RemainingSafe int
+	Mines         int
+
+	// Completion is the percentage of safe cells revealed so far.
+	Completion float64
+}
+
+// Stats gathers up the game's progress in one go. It can be called at any point in the game.
+func (g *game) Stats() BoardStats {
+	stats := BoardStats{
+		Flagged:       g.flagCount,
+		RemainingSafe: g.RemainingSafeCells(),
+		Mines:         g.mineCount,
+	}
+
+	g.forEachCell(func(_ coordinate, target *cell) {
+		if target.isRevealed {
+			stats.Revealed++
+		}
+	})
+
+	if safe := g.cellCount - g.mineCount; safe > 0 {
+		stats.Completion = 100 * float64(g.revealedSafeCount) / float64(safe)
+	}
+
+	return stats
+}
+
+// SafeOpenings lists the cells with no adjacent mines, any of which is a safe first click that
+// opens up part of the board. It's only meant as a hint for the first move, so it returns
+// nothing once any cell has been revealed.
+func (g *game) SafeOpenings() []CellName {
+	openings := []CellName{}
+	if g.revealedSafeCount > 0 || g.isEnded {
+		return openings
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if !target.isMined && target.adjacentMines == 0 {
+			openings = append(openings, coordinateToCellName(c))
+		}
+	})
+
+	return openings
+}
+
+// VerifyFlags checks the player's flags, splitting them into those on mines and those which
+// aren't. It gives away where mines are, so should only be called when the player asks.
+func (g *game) VerifyFlags() (correct, incorrect []CellName) {
+	correct = []CellName{}
+	incorrect = []CellName{}
+	g.forEachCell(func(c coordinate, target *cell) {
+		if !target.isFlagged {
+			return
+		}
+
+		if target.isMined {
+			correct = append(correct, coordinateToCellName(c))
+		} else {
+			incorrect = append(incorrect, coordinateToCellName(c))
+		}
+	})
+
+	return correct, incorrect
+}
+
+// RevealRandomSafe reveals a cell chosen at random from those which are safe, to help out
+// new players.
+func (g *game) RevealRandomSafe() (CellName, error) {
+	if len(g.grid) == 0 {
+		return "", ErrGameNotStarted
+	} else if g.isEnded {
+		return "", ErrGameEnded
+	}
+
+	safe := []coordinate{}
+	g.forEachCell(func(c coordinate, target *cell) {
+		if !target.isRevealed && !target.isFlagged && !target.isMined {
+			safe = append(safe, c)
+		}
+	})
+
+	if len(safe) == 0 {
+		return "", fmt.Errorf("No safe cells left to reveal.")
+	}
+
+	g.source = SourceAI
+	defer func() { g.source = SourceUser }()
+
+	cellName := coordinateToCellName(safe[g.rng.Intn(len(safe))])
+	return cellName, g.RevealCell(cellName)
+}
+
+// RevealAllSafe reveals every safe cell left, which wins the game unless it's won by flagging.
+// It's a shortcut for tests and tutorials which need a board that's finished, or nearly so.
+// Flags on safe cells are removed first, as the player would have to.
+func (g *game) RevealAllSafe() (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	if g.isEnded {
+		return ErrGameEnded
+	}
+
+	g.moves = append(g.moves, len(g.events))
+
+	var last coordinate
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isMined || target.isRevealed {
+			return
+		}
+
+		base := eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		}
+
+		if target.isFlagged {
+			unflagged := cellUnflaggedEvent{BaseEvent: base, CellCoord: c, Source: g.source}
+			unflagged.applyTo(g)
+			g.appendEvents(unflagged)
+			base.Version++
+		}
+
+		revealed := cellRevealedEvent{
+			BaseEvent:           base,
+			InteractionCellName: coordinateToCellName(c),
+			CellCoord:           c,
+			RemainingSafe:       g.remainingSafeAfter(c),
+			Source:              g.source,
+		}
+		revealed.applyTo(g)
+		g.appendEvents(revealed)
+		last = c
+	})
+
+	if won := g.winGameIfLastCell(last); won != nil {
+		g.appendEvents(won)
+	}
+	g.winGameIfCleared()
+
+	return nil
+}
+
+// LastActivity is when the latest event happened, or when the game was created if nothing has
+// happened since, e.g. to show when a game was last played.
+func (g *game) LastActivity() time.Time {
+	return g.updatedAt
+}
+
+// ExpiresAt is when the game will expire if no more moves are made, or the zero time if it
+// never expires.
+func (g *game) ExpiresAt() time.Time {
+	if g.options.MaxIdle == 0 {
+		return time.Time{}
+	}
+
+	return g.updatedAt.Add(g.options.MaxIdle)
+}
+
+// IsExpired reports whether the game has gone idle for longer than allowed as of now.
+func (g *game) IsExpired(now time.Time) bool {
+	return g.options.MaxIdle > 0 && now.After(g.ExpiresAt())
+}
+
+// MinesRemaining is the number of mines less the number of flags placed, as shown on a
+// classic minesweeper counter. It may go negative if the player over-flags.
+func (g *game) MinesRemaining() int {
+	return g.mineCount - g.flagCount
+}
+
+// UserRevealedCount is how many cells have been revealed directly, e.g. by clicking them.
+func (g *game) UserRevealedCount() int {
+	return g.userRevealedCount
+}
+
+// CascadeRevealedCount is how many cells have been opened up by cascades from other cells.
+func (g *game) CascadeRevealedCount() int {
+	return g.cascadeRevealedCount
+}
+
+// UnflaggedMines counts the mines which aren't flagged, unlike MinesRemaining, which trusts
+// every flag to be on a mine. It relies on where the mines really are, so like MineMap it's
+// for reviewing a finished game or debugging, and must never be shown to a player who's still
+// playing.
+func (g *game) UnflaggedMines() int {
+	unflagged := 0
+	g.forEachCell(func(_ coordinate, target *cell) {
+		if target.isMined && !target.isFlagged {
+			unflagged++
+		}
+	})
+
+	return unflagged
+}
+
+// AdjacentMines gives the number shown on a revealed cell. Unrevealed cells are an error, so
+// as not to give away anything the player can't see.
+func (g *game) AdjacentMines(cellName CellName) (int, error) {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return 0, err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return 0, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	target := g.grid[coord[1]][coord[0]]
+	if !target.isRevealed {
+		return 0, fmt.Errorf("Cell %s hasn't been revealed yet.", cellName)
+	}
+
+	if target.isMined {
+		return 0, fmt.Errorf("Cell %s is a mine, so has no number.", cellName)
+	}
+
+	return target.adjacentMines, nil
+}
+
+// AdjacentFlags gives how many of a cell's neighbors are flagged, e.g. so a UI can tint numbers
+// which already have all their flags. Flags are visible to the player, so any cell may be
+// asked about.
+func (g *game) AdjacentFlags(cellName CellName) (int, error) {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return 0, err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return 0, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	return g.adjacentFlagCount(coord), nil
+}
+
+// UnrevealedNeighbors lists a cell's neighbors which are still to be revealed, e.g. to highlight
+// where a number's mines could be. They're listed in reading order. Flagged neighbors are left
+// out, as AdjacentFlags counts them.
+func (g *game) UnrevealedNeighbors(cellName CellName) ([]CellName, error) {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return nil, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	unrevealed := []CellName{}
+	for _, n := range getNeighborsOrdered(coord, len(g.grid[0]), len(g.grid), g.options.Adjacency) {
+		if neighbor := g.grid[n[1]][n[0]]; !neighbor.isRevealed && !neighbor.isFlagged {
+			unrevealed = append(unrevealed, coordinateToCellName(n))
+		}
+	}
+
+	return unrevealed, nil
+}
+
+// WasMine reports whether a cell is mined, for reviewing a finished game. It refuses to answer
+// while the game is still being played, so as not to give the solution away.
+func (g *game) WasMine(cellName CellName) (bool, error) {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return false, err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return false, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	if !g.isEnded {
+		return false, fmt.Errorf("Cannot check for mines until the game is over.")
+	}
+
+	return g.grid[coord[1]][coord[0]].isMined, nil
+}
+
+// MineMap gives where every mine is, e.g. for a server to check answers or an admin to show
+// the solution. It gives the game away, so unlike Snapshot it must never be sent to a player
+// who's still playing.
+func (g *game) MineMap() [][]bool {
+	mines := make([][]bool, len(g.grid))
+	for y := range g.grid {
+		mines[y] = make([]bool, len(g.grid[y]))
+		for x := range g.grid[y] {
+			mines[y][x] = g.grid[y][x].isMined
+		}
+	}
+
+	return mines
+}
+
+// EditorView gives every cell's count of adjacent mines, revealed or not, with -1 for mines,
+// so puzzle designers can see the whole board as they edit it. It's only available in editor
+// mode, and is nil otherwise.
+func (g *game) EditorView() [][]int {
+	if !g.options.EditorMode {
+		return nil
+	}
+
+	view := make([][]int, len(g.grid))
+	for y := range view {
+		view[y] = make([]int, len(g.grid[y]))
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		count := target.adjacentMines
+		if target.isMined {
+			count = -1
+		}
+		view[c[1]][c[0]] = count
+	})
+
+	return view
+}
+
+// FlagCell toggles a flag on an unrevealed cell.
+func (g *game) FlagCell(cellName CellName) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	if g.isEnded {
+		return ErrGameEnded
+	}
+
+	target := g.grid[coord[1]][coord[0]]
+	if target.isRevealed {
+		return fmt.Errorf("Cell %s already revealed", cellName)
+	}
+
+	base := eventsource.BaseEvent{
+		AggregateId: g.id,
+		Version:     g.version + 1,
+		At:          clock(),
+	}
+
+	// Unflagging is always allowed.
+	if target.isFlagged {
+		unflagged := cellUnflaggedEvent{BaseEvent: base, CellCoord: coord, Source: g.source}
+		g.moves = append(g.moves, len(g.events))
+		unflagged.applyTo(g)
+		g.appendEvents(unflagged)
+
+		// Taking a misplaced flag away may leave only the mines flagged.
+		if won := g.winGameIfLastCell(coord); won != nil {
+			g.appendEvents(won)
+		}
+		return nil
+	}
+
+	if g.options.StrictFlags && g.flagCount >= g.mineCount {
+		return fmt.Errorf("Cannot place more flags than there are mines (%d).", g.mineCount)
+	}
+
+	flagged := cellFlaggedEvent{BaseEvent: base, CellCoord: coord, Source: g.source}
+	g.moves = append(g.moves, len(g.events))
+	flagged.applyTo(g)
+	g.appendEvents(flagged)
+
+	if won := g.winGameIfLastCell(coord); won != nil {
+		g.appendEvents(won)
+	}
+
+	return nil
+}
+
+func (g *game) onCellFlagged(e cellFlaggedEvent) {
+	g.grid[e.CellCoord[1]][e.CellCoord[0]].isFlagged = true
+	g.revealedOrFlaggedCellCount++
+	g.flagCount++
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+func (g *game) onCellUnflagged(e cellUnflaggedEvent) {
+	g.grid[e.CellCoord[1]][e.CellCoord[0]].isFlagged = false
+	g.revealedOrFlaggedCellCount--
+	g.flagCount--
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+// AnnotateCell attaches a note to a cell, e.g. a player's guess at how likely it is to be
+// mined when learning the odds. Notes show up in snapshots, but have no effect on play, so
+// they can be made even once the game has ended, and are kept when moves are undone. An empty
+// note removes the cell's note.
+func (g *game) AnnotateCell(cellName CellName, note string) (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil {
+		return err
+	}
+
+	if !containsCoordinate(coord, g.grid) {
+		return fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+	}
+
+	annotated := cellAnnotatedEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+		CellCoord: coord,
+		Note:      note,
+	}
+
+	// Notes aren't moves, so they can't be undone by themselves, and don't stop undone moves
+	// being redone.
+	undone := g.undone
+	annotated.applyTo(g)
+	g.appendEvents(annotated)
+	g.undone = undone
+
+	return nil
+}
+
+func (g *game) onCellAnnotated(e cellAnnotatedEvent) {
+	if e.Note == "" {
+		delete(g.notes, e.CellCoord)
+	} else {
+		g.notes[e.CellCoord] = e.Note
+	}
+	g.version = e.Version
+	g.updatedAt = e.At
+}
+
+// recoverMove turns a panic part way through a move into an ErrInternal, so that one broken
+// game can't bring down everything else. It's deferred at the start of each move with the
+// events and moves so far, and rolls the game back to them. Spectators may already have been
+// sent some of the abandoned events, so they're sent the log again.
+func (g *game) recoverMove(events []event, moves []int, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	*err = fmt.Errorf("%w The move was abandoned: %v", ErrInternal, r)
+	g.moves = moves
+	g.replay(events)
+	g.resync()
+}
+
+// recordEvents makes a move, returning the events it added. Compaction may rewrite the log
+// during the move, so they can't be found by where the log ended beforehand.
+func (g *game) recordEvents(move func() error) ([]event, error) {
+	outer := g.added
+	added := []event{}
+	g.added = &added
+	err := move()
+
+	// Recordings can be nested, so pass the events on to any outer one.
+	g.added = outer
+	if outer != nil {
+		*outer = append(*outer, added...)
+	}
+
+	return added, err
+}
+
+// appendEvents adds newly applied events to the log, streams them to any spectators, and
+// lets anyone waiting for the game to end know when it does.
+func (g *game) appendEvents(events ...event) {
+	// Undone moves no longer follow on from a new event, so can't be redone.
+	g.undone = nil
+	g.events = append(g.events, events...)
+	if g.added != nil {
+		*g.added = append(*g.added, events...)
+	}
+	compacted := false
+	if max := g.options.MaxEvents; max > 0 && len(g.events) > max && !g.isEnded {
+		g.compactEvents()
+		compacted = true
+	}
+
+	// The compacted log takes the place of everything before, new events included.
+	if compacted {
+		g.resync()
+	}
+
+	for _, e := range events {
+		if !compacted {
+			for _, ch := range g.spectators {
+				ch <- recordOf(e)
+			}
+		}
+
+		switch v := e.(type) {
+		case gameWonEvent:
+			for _, fn := range g.onWin {
+				fn()
+			}
+		case gameLostEvent:
+			for _, fn := range g.onLose {
+				fn(coordinateToCellName(v.DetonatedCoord))
+			}
+		case cellRevealedEvent:
+			for _, fn := range g.onCascade {
+				if v.ByCascade {
+					fn(coordinateToCellName(v.CellCoord))
+				}
+			}
+		case cellsRevealedEvent:
+			// Any cells revealed directly come first, ahead of the cascade.
+			for _, c := range v.CellCoords[len(v.CellCoords)-v.Cascaded:] {
+				for _, fn := range g.onCascade {
+					fn(coordinateToCellName(c))
+				}
+			}
+		}
+	}
+}
+
+// compactEvents replaces the event log with the fewest events which replay to the current
+// state: the game starting on the board as it is now, every revealed cell at once, then each
+// flag and note. The last of them carries the current version, so later events carry on from
+// it. The undo history refers to the old log, so it's forgotten.
+func (g *game) compactEvents() {
+	started := g.events[0].(gameStartedEvent)
+
+	// The board may have changed since it started (e.g., defused cells), so start from how it
+	// is now, with nothing revealed or flagged.
+	started.grid = make([][]cell, len(g.grid))
+	revealed := []coordinate{}
+	flagged := []coordinate{}
+	noted := []coordinate{}
+	for y := range g.grid {
+		started.grid[y] = make([]cell, len(g.grid[y]))
+	}
+	g.forEachCell(func(c coordinate, target *cell) {
+		started.grid[c[1]][c[0]] = cell{isMined: target.isMined, adjacentMines: target.adjacentMines}
+		if target.isRevealed {
+			revealed = append(revealed, c)
+		}
+		if target.isFlagged {
+			flagged = append(flagged, c)
+		}
+		if _, ok := g.notes[c]; ok {
+			noted = append(noted, c)
+		}
+	})
+
+	events := []event{started}
+	count := len(flagged) + len(noted)
+	if len(revealed) > 0 {
+		count++
+	}
+
+	// The start moves up to just before the rest, so that the versions carry on without a gap.
+	started.Version = g.version - count
+	events[0] = started
+
+	base := func() eventsource.BaseEvent {
+		return eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version - count + len(events),
+			At:          g.updatedAt,
+		}
+	}
+
+	if len(revealed) > 0 {
+		events = append(events, cellsRevealedEvent{BaseEvent: base(), CellCoords: revealed, RemainingSafe: g.RemainingSafeCells(), Cascaded: g.cascadeRevealedCount})
+	}
+
+	for _, c := range flagged {
+		events = append(events, cellFlaggedEvent{BaseEvent: base(), CellCoord: c})
+	}
+
+	for _, c := range noted {
+		events = append(events, cellAnnotatedEvent{BaseEvent: base(), CellCoord: c, Note: g.notes[c]})
+	}
+
+	g.events = events
+	g.moves = nil
+}
+
+// OnWin registers fn to be called when the game is won.
+func (g *game) OnWin(fn func()) {
+	g.onWin = append(g.onWin, fn)
+}
+
+// OnLose registers fn to be called when the game is lost, with the mined cell which was
+// revealed.
+func (g *game) OnLose(fn func(detonated CellName)) {
+	g.onLose = append(g.onLose, fn)
+}
+
+// OnCascade registers fn to be called for each cell a cascade opens up, in the order they're
+// revealed, e.g. so a client can animate the cascade by drawing or pausing between cells. The
+// whole cascade has already been played by then, so fn can't change how it goes.
+func (g *game) OnCascade(fn func(revealed CellName)) {
+	g.onCascade = append(g.onCascade, fn)
+}
+
+// EventChannel streams a record of each new event as it's applied, e.g. for spectators
+// following a game live. When the log is rewritten instead (e.g., a move is undone, or the log
+// is compacted), the whole of the new log is sent, so spectators should start over from each
+// GameStarted. The channel is buffered, but moves will block if it fills up, so keep reading
+// until it's closed by Close.
+func (g *game) EventChannel() <-chan EventRecord {
+	ch := make(chan EventRecord, 64)
+	g.spectators = append(g.spectators, ch)
+
+	return ch
+}
+
+// resync sends spectators the whole log, for when it's been rewritten rather than added to.
+func (g *game) resync() {
+	for _, e := range g.events {
+		for _, ch := range g.spectators {
+			ch <- recordOf(e)
+		}
+	}
+}
+
+// Records gives a record of each event in the log after the given version, in order, e.g. for
+// copying a move's events to an event store. Zero gives the whole log.
+func (g *game) Records(since int) []EventRecord {
+	records := []EventRecord{}
+	for _, e := range g.events {
+		if r := recordOf(e); r.Version > since {
+			records = append(records, r)
+		}
+	}
+
+	return records
+}
+
+// Close stops streaming events, closing every channel given out by EventChannel.
+func (g *game) Close() {
+	for _, ch := range g.spectators {
+		close(ch)
+	}
+	g.spectators = nil
+}
+
+// UndoMove takes back the player's last move, along with everything which followed from it
+// (e.g., cascading reveals, or losing the game).
+func (g *game) UndoMove() (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.moves) == 0 {
+		return fmt.Errorf("No moves to undo.")
+	}
+
+	last := g.moves[len(g.moves)-1]
+	g.moves = g.moves[:len(g.moves)-1]
+
+	// Copied, since the events kept will be appended to over the top of the rest. Notes made
+	// since the move aren't part of it, so they're kept.
+	undone, notes := []event{}, []event{}
+	for _, e := range g.events[last:] {
+		if _, ok := e.(cellAnnotatedEvent); ok {
+			notes = append(notes, e)
+		} else {
+			undone = append(undone, e)
+		}
+	}
+	g.undone = append(g.undone, undone)
+
+	if err := g.replay(g.events[:last]); err != nil {
+		return err
+	}
+
+	for _, e := range notes {
+		e = withVersion(e, g.version+1)
+		e.applyTo(g)
+		g.events = append(g.events, e)
+	}
+	g.resync()
+
+	return nil
+}
+
+// UndoMoves takes back the player's last n moves, as though UndoMove were called n times.
+func (g *game) UndoMoves(n int) error {
+	if n < 1 || n > len(g.moves) {
+		return fmt.Errorf("Cannot undo %d moves. Must be between 1 and %d.", n, len(g.moves))
+	}
+
+	for i := 0; i < n; i++ {
+		if err := g.UndoMove(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RedoMove plays the last undone move again, exactly as it happened the first time. Moves
+// can be redone until a new one is made.
+func (g *game) RedoMove() (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.undone) == 0 {
+		return fmt.Errorf("No moves to redo.")
+	}
+
+	redo := g.undone[len(g.undone)-1]
+	rest := g.undone[:len(g.undone)-1]
+
+	// Notes may have been made since the move was undone, so it carries on from them.
+	redo = append([]event(nil), redo...)
+	g.moves = append(g.moves, len(g.events))
+	for i, e := range redo {
+		redo[i] = withVersion(e, g.version+1)
+		redo[i].applyTo(g)
+	}
+	g.appendEvents(redo...)
+	g.undone = rest
+
+	return nil
+}
+
+// Reset takes the game back to how it started, with the same mines, so the board can be played
+// again from scratch. Everything after the start is dropped from the log, so can't be undone or
+// redone afterwards.
+func (g *game) Reset() (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	g.moves = nil
+	g.undone = nil
+	if err := g.replay(g.events[:1]); err != nil {
+		return err
+	}
+	g.resync()
+
+	return nil
+}
+
+// Reshuffle starts a new board the same size as the last, with as many mines but laid out
+// afresh, for another go without setting the game up again. Like Reset, it drops everything
+// before from the log, but the new start carries on from the game's version. The new board has
+// a seed of its own, which Seed reports afterwards.
+func (g *game) Reshuffle() (err error) {
+	defer g.recoverMove(g.events, g.moves, &err)
+
+	if len(g.grid) == 0 {
+		return ErrGameNotStarted
+	}
+
+	// Draw the new seed from the game's chance, so that reshuffles follow on from the first seed.
+	opts := g.options
+	for opts.Seed == 0 || opts.Seed == g.options.Seed {
+		opts.Seed = g.rng.Int63()
+	}
+
+	rng := newRandom(opts.Seed)
+	grid, err := generateGrid(len(g.grid[0]), len(g.grid), g.mineCount, opts, rng)
+	if err != nil {
+		return err
+	}
+	g.options, g.rng = opts, rng
+
+	started := gameStartedEvent{
+		BaseEvent: eventsource.BaseEvent{
+			AggregateId: g.id,
+			Version:     g.version + 1,
+			At:          clock(),
+		},
+		grid: grid,
+	}
+
+	g.events = nil
+	g.moves = nil
+	started.applyTo(g)
+	g.appendEvents(started)
+
+	return nil
+}
+
+// replay rebuilds the game's state by applying the given events in order, which then become
+// the game's event log. Each is checked first to make sure it could really have happened given
+// those before it, since they may come from somewhere untrusted (e.g., a saved file). It stops
+// at the first which couldn't, reporting which it was and why.
+func (g *game) replay(events []event) error {
+	for i, e := range events {
+		if err := g.checkEvent(e); err != nil {
+			return fmt.Errorf("Cannot replay event %d: %s", i+1, err)
+		}
+
+		e.applyTo(g)
+	}
+	g.events = events
+
+	return nil
+}
+
+// MergeEvents reconciles two logs of the same game, e.g. from devices which played it offline.
+// If one log is the other with more events on the end, the longer is returned. Otherwise
+// they've diverged, and it's an error naming the first version at which they differ.
+func MergeEvents(a, b []event) ([]event, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if !sameEvent(a[i], b[i]) {
+			return nil, fmt.Errorf("Cannot merge event logs. They diverge at version %d.", recordOf(a[i]).Version)
+		}
+	}
+
+	if len(b) > len(a) {
+		return b, nil
+	}
+
+	return a, nil
+}
+
+// sameEvent says whether two events are the same, comparing them as they'd be saved. Times are
+// compared as instants, so an event loaded from a save matches the one still in memory.
+func sameEvent(a, b event) bool {
+	savedA, savedB := saveEvent(a), saveEvent(b)
+	if !savedA.At.Equal(savedB.At) {
+		return false
+	}
+	savedA.At, savedB.At = time.Time{}, time.Time{}
+
+	return reflect.DeepEqual(savedA, savedB)
+}
+
+// checkEvent makes sure an event is possible in the game's current state.
+func (g *game) checkEvent(e event) error {
+	if started, ok := e.(gameStartedEvent); ok {
+		return validateGrid(started.grid)
+	}
+
+	if len(g.grid) == 0 {
+		return fmt.Errorf("The game hasn't started.")
+	}
+
+	// Nothing happens once the game has ended, but notes, which have no effect on play.
+	if _, ok := e.(cellAnnotatedEvent); g.isEnded && !ok {
+		return fmt.Errorf("The game has already ended.")
+	}
+
+	// Every other event happens to cells on the board.
+	cellAt := func(c coordinate) (*cell, error) {
+		if !containsCoordinate(c, g.grid) {
+			return nil, fmt.Errorf("Invalid cell %s (%d,%d).", coordinateToCellName(c), c[0], c[1])
+		}
+
+		return &g.grid[c[1]][c[0]], nil
+	}
+
+	revealable := func(c coordinate) error {
+		target, err := cellAt(c)
+		if err == nil && target.isRevealed {
+			err = fmt.Errorf("Cell %s already revealed", coordinateToCellName(c))
+		}
+
+		return err
+	}
+
+	switch v := e.(type) {
+	case cellRevealedEvent:
+		return revealable(v.CellCoord)
+	case cellsRevealedEvent:
+		for _, c := range v.CellCoords {
+			if err := revealable(c); err != nil {
+				return err
+			}
+		}
+	case cellFlaggedEvent:
+		target, err := cellAt(v.CellCoord)
+		if err != nil {
+			return err
+		} else if target.isRevealed || target.isFlagged {
+			return fmt.Errorf("Cell %s can't be flagged", coordinateToCellName(v.CellCoord))
+		}
+	case cellUnflaggedEvent:
+		target, err := cellAt(v.CellCoord)
+		if err != nil {
+			return err
+		} else if !target.isFlagged {
+			return fmt.Errorf("Cell %s isn't flagged", coordinateToCellName(v.CellCoord))
+		}
+	case cellDefusedEvent:
+		target, err := cellAt(v.CellCoord)
+		if err != nil {
+			return err
+		} else if !target.isMined {
+			return fmt.Errorf("Cell %s isn't mined", coordinateToCellName(v.CellCoord))
+		}
+	case cellAnnotatedEvent:
+		_, err := cellAt(v.CellCoord)
+		return err
+	case gameLostEvent:
+		_, err := cellAt(v.DetonatedCoord)
+		return err
+	}
+
+	return nil
+}
+
+// IsComplete is whether the game has ended, whether it was won or lost.
 func (g *game) IsComplete() bool {
-	return false
+	return g.isEnded
 }
 
 type cell struct {
@@ -256,10 +1939,56 @@ type cell struct {
 	adjacentMines int
 }
 
+// forEachCell calls fn with every cell in the grid, in row-major order. Going through here
+// avoids mixing up x and y when indexing the grid directly.
+func (g *game) forEachCell(fn func(coordinate, *cell)) {
+	for y := 0; y < len(g.grid); y++ {
+		for x := 0; x < len(g.grid[y]); x++ {
+			fn(coordinate{x, y}, &g.grid[y][x])
+		}
+	}
+}
+
 type event interface {
 	applyTo(g *game)
 }
 
+// withVersion gives a copy of the event at another version, for when events are moved around
+// the log, e.g. notes kept when the move before them is undone.
+func withVersion(e event, version int) event {
+	switch v := e.(type) {
+	case gameStartedEvent:
+		v.Version = version
+		return v
+	case cellRevealedEvent:
+		v.Version = version
+		return v
+	case cellsRevealedEvent:
+		v.Version = version
+		return v
+	case cellFlaggedEvent:
+		v.Version = version
+		return v
+	case cellUnflaggedEvent:
+		v.Version = version
+		return v
+	case cellDefusedEvent:
+		v.Version = version
+		return v
+	case cellAnnotatedEvent:
+		v.Version = version
+		return v
+	case gameWonEvent:
+		v.Version = version
+		return v
+	case gameLostEvent:
+		v.Version = version
+		return v
+	}
+
+	return e
+}
+
 type gameStartedEvent struct {
 	eventsource.BaseEvent
 	grid [][]cell
@@ -273,13 +2002,76 @@ type cellRevealedEvent struct {
 	eventsource.BaseEvent
 	InteractionCellName CellName
 	CellCoord           coordinate
+
+	// RemainingSafe is how many safe cells are left to reveal afterwards, e.g. for a progress
+	// bar. It's recorded rather than worked out again, so replays give the same figures.
+	RemainingSafe int
+
+	// ByCascade is set when the cell was opened up by a cascade, rather than revealed directly.
+	ByCascade bool
+	Source    Source
 }
 
 func (e cellRevealedEvent) applyTo(g *game) {
 	g.onCellRevealed(e)
 }
 
-type cellFlaggedEvent struct{}
+// cellsRevealedEvent reveals several cells at once, as a compacted form of a cellRevealedEvent
+// and those of its cascade.
+type cellsRevealedEvent struct {
+	eventsource.BaseEvent
+	InteractionCellName CellName
+	CellCoords          []coordinate
+	RemainingSafe       int
+
+	// Cascaded is how many of the cells were opened up by a cascade. The rest were revealed
+	// directly.
+	Cascaded int
+	Source   Source
+}
+
+func (e cellsRevealedEvent) applyTo(g *game) {
+	g.onCellsRevealed(e)
+}
+
+type cellFlaggedEvent struct {
+	eventsource.BaseEvent
+	CellCoord coordinate
+	Source    Source
+}
+
+func (e cellFlaggedEvent) applyTo(g *game) {
+	g.onCellFlagged(e)
+}
+
+type cellUnflaggedEvent struct {
+	eventsource.BaseEvent
+	CellCoord coordinate
+	Source    Source
+}
+
+func (e cellUnflaggedEvent) applyTo(g *game) {
+	g.onCellUnflagged(e)
+}
+
+type cellDefusedEvent struct {
+	eventsource.BaseEvent
+	CellCoord coordinate
+}
+
+func (e cellDefusedEvent) applyTo(g *game) {
+	g.onCellDefused(e)
+}
+
+type cellAnnotatedEvent struct {
+	eventsource.BaseEvent
+	CellCoord coordinate
+	Note      string
+}
+
+func (e cellAnnotatedEvent) applyTo(g *game) {
+	g.onCellAnnotated(e)
+}
 
 type gameWonEvent struct {
 	eventsource.BaseEvent
@@ -291,6 +2083,7 @@ func (e gameWonEvent) applyTo(g *game) {
 
 type gameLostEvent struct {
 	eventsource.BaseEvent
+	DetonatedCoord coordinate
 }
 
 func (e gameLostEvent) applyTo(g *game) {
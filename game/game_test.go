@@ -1,7 +1,13 @@
 package game
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
 	"testing"
+	"time"
+
+	"zephyri.co/mineswept/eventsource"
 )
 
 func TestNewGameShouldErrorOnTooWide(t *testing.T) {
@@ -39,6 +45,54 @@ func TestNewGameShouldErrorOnTooManyMines(t *testing.T) {
 	}
 }
 
+func TestNewGameShouldErrorOnAllMines(t *testing.T) {
+	_, err := NewGame(20, 20, 400)
+	if err == nil {
+		t.Error("Expected error for as many mines as cells.")
+	}
+}
+
+func TestNewGameAllowsOneSafeCell(t *testing.T) {
+	g, err := NewGame(20, 20, 399)
+	if err != nil {
+		t.Fatalf("Unexpected error for one fewer mine than cells: %s", err)
+	}
+
+	if g.RemainingSafeCells() != 1 {
+		t.Errorf("Expected exactly one safe cell (found %d)", g.RemainingSafeCells())
+	}
+}
+
+func TestConstructorsShareMineCountLimits(t *testing.T) {
+	constructors := map[string]func(mineCount int) (*game, error){
+		"NewGame": func(mineCount int) (*game, error) {
+			return NewGame(2, 2, mineCount)
+		},
+		"NewGameWithDensity": func(mineCount int) (*game, error) {
+			return NewGameWithDensity(2, 2, float64(mineCount)/4)
+		},
+		"NewGameFromLayout": func(mineCount int) (*game, error) {
+			return NewGameFromLayout([]CellName{"A1", "B1", "A2", "B2"}[:mineCount], 2, 2)
+		},
+	}
+
+	for name, construct := range constructors {
+		if _, err := construct(3); err != nil {
+			t.Errorf("%s should allow a single safe cell: %s", name, err)
+		}
+
+		expected := map[int]string{
+			0: "Invalid mine count 0. Must be between 1 and 3.",
+			4: "Invalid mine count 4. Must be between 1 and 3.",
+		}
+		for mineCount, message := range expected {
+			if _, err := construct(mineCount); err == nil || err.Error() != message {
+				t.Errorf("%s with %d mines should fail with %q (found %v)", name, mineCount, message, err)
+			}
+		}
+	}
+}
+
 func TestNewGame(t *testing.T) {
 	g, err := NewGame(10, 10, 10)
 	if err != nil {
@@ -165,3 +219,1721 @@ func TestRevealCell(t *testing.T) {
 		}
 	}
 }
+
+func TestDefuseCell(t *testing.T) {
+	g, _ := NewGameWithOptions(5, 5, 5, Options{EditorMode: true})
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Try a cell without a mine.
+	err := g.DefuseCell("A1")
+	if err == nil {
+		t.Errorf("Failed to detect defusing a cell without a mine")
+	}
+
+	// Defuse the mine at D1.
+	err = g.DefuseCell("D1")
+	if err != nil {
+		t.Errorf("Failed to defuse cell D1: %s", err)
+	}
+
+	if g.grid[0][3].isMined {
+		t.Error("Failed to remove mine from D1")
+	}
+
+	if g.mineCount != 4 {
+		t.Errorf("Mine count should drop to 4 (is %d)", g.mineCount)
+	}
+
+	expectedCounts := map[CellName]int{"C1": 1, "D1": 0, "E1": 0, "C2": 1, "D2": 0, "E2": 0}
+	for cellName, expected := range expectedCounts {
+		coord, _ := cellNameToCoordinate(cellName)
+		if found := g.grid[coord[1]][coord[0]].adjacentMines; found != expected {
+			t.Errorf("Cell %s should have %d adjacent mines (has %d)", cellName, expected, found)
+		}
+	}
+
+	// Defusing is only allowed in editor mode.
+	g, _ = NewGame(5, 5, 5)
+	event = g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	err = g.DefuseCell("D1")
+	if err == nil {
+		t.Errorf("Failed to prevent defusing outside of editor mode")
+	}
+}
+
+func TestEventTimestampsUseClock(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	useFakeClock(t, start, time.Second)
+
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Reveal a cell with no adjacent mines so that several events are generated.
+	err := g.RevealCell("E3")
+	if err != nil {
+		t.Errorf("Failed to reveal cell E3: %s", err)
+	}
+
+	if len(g.events) < 2 {
+		t.Fatalf("Expected multiple events after cascading reveal (found %d)", len(g.events))
+	}
+
+	for i, e := range g.events {
+		var at time.Time
+		switch v := e.(type) {
+		case gameStartedEvent:
+			at = v.At
+		case cellRevealedEvent:
+			at = v.At
+		default:
+			t.Fatalf("Unexpected event type %T", v)
+		}
+
+		expected := start.Add(time.Duration(i) * time.Second)
+		if !at.Equal(expected) {
+			t.Errorf("Event %d should be at %s (is %s)", i, expected, at)
+		}
+	}
+
+	if !g.updatedAt.Equal(start.Add(time.Duration(len(g.events)-1) * time.Second)) {
+		t.Errorf("Game updatedAt should match the last event (is %s)", g.updatedAt)
+	}
+}
+
+func TestRemainingSafeCells(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	if remaining := g.RemainingSafeCells(); remaining != 20 {
+		t.Errorf("Expected 20 safe cells before any reveal (found %d)", remaining)
+	}
+
+	// Revealing E3 cascades to 8 neighbors as well.
+	g.RevealCell("E3")
+	if remaining := g.RemainingSafeCells(); remaining != 11 {
+		t.Errorf("Expected 11 safe cells after revealing E3 (found %d)", remaining)
+	}
+
+	// Reveal the rest of the safe cells one at a time.
+	rest := []CellName{"A1", "B1", "C1", "E1", "A2", "A3", "B3", "A5", "B5", "C5", "D5"}
+	for i, cellName := range rest {
+		if g.isEnded {
+			t.Fatalf("Game ended before revealing %s", cellName)
+		}
+
+		err := g.RevealCell(cellName)
+		if err != nil {
+			t.Errorf("Failed to reveal cell %s: %s", cellName, err)
+		}
+
+		if remaining := g.RemainingSafeCells(); remaining != len(rest)-i-1 {
+			t.Errorf("Expected %d safe cells after revealing %s (found %d)", len(rest)-i-1, cellName, remaining)
+		}
+	}
+
+	if !g.isEnded {
+		t.Error("Game should end once no safe cells remain")
+	}
+
+	switch v := g.events[len(g.events)-1].(type) {
+	case gameWonEvent:
+		// Good!
+	default:
+		t.Errorf("Game's last event should be a gameWonEvent (is %T)", v)
+	}
+}
+
+func TestStrictFlags(t *testing.T) {
+	g, _ := NewGameWithOptions(5, 5, 5, Options{StrictFlags: true})
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Flag as many cells as there are mines (correctly or not).
+	for _, cellName := range []CellName{"A1", "B1", "C1", "D1", "E1"} {
+		err := g.FlagCell(cellName)
+		if err != nil {
+			t.Errorf("Failed to flag cell %s: %s", cellName, err)
+		}
+	}
+
+	if remaining := g.MinesRemaining(); remaining != 0 {
+		t.Errorf("Expected 0 mines remaining after placing 5 flags (found %d)", remaining)
+	}
+
+	// One more flag is too many.
+	err := g.FlagCell("A2")
+	if err == nil {
+		t.Error("Failed to prevent placing more flags than mines")
+	}
+
+	if g.grid[1][0].isFlagged {
+		t.Error("Incorrectly flagged cell A2")
+	}
+
+	if remaining := g.MinesRemaining(); remaining != 0 {
+		t.Errorf("Expected 0 mines remaining after a rejected flag (found %d)", remaining)
+	}
+
+	// Unflagging is always allowed, and frees up a flag.
+	err = g.FlagCell("A1")
+	if err != nil {
+		t.Errorf("Failed to unflag cell A1: %s", err)
+	}
+
+	if g.grid[0][0].isFlagged {
+		t.Error("Failed to unflag cell A1")
+	}
+
+	err = g.FlagCell("A2")
+	if err != nil {
+		t.Errorf("Failed to flag cell A2 after unflagging A1: %s", err)
+	}
+}
+
+func TestForEachCell(t *testing.T) {
+	g := &game{grid: initEmptyGrid(3, 2)}
+
+	visited := []coordinate{}
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target != &g.grid[c[1]][c[0]] {
+			t.Errorf("Cell passed for %s doesn't match the grid", c)
+		}
+		visited = append(visited, c)
+	})
+
+	expected := []coordinate{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 1}, {2, 1}}
+	if len(visited) != len(expected) {
+		t.Fatalf("Expected %d cells to be visited (visited %d)", len(expected), len(visited))
+	}
+
+	for i := range expected {
+		if visited[i] != expected[i] {
+			t.Errorf("Expected cells in row-major order %s, visited %s", expected, visited)
+			break
+		}
+	}
+}
+
+func TestRevealThenChord(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Flag the only mine next to A1, so that revealing A1 also opens its other neighbors.
+	g.FlagCell("B2")
+	err := g.RevealThenChord("A1")
+	if err != nil {
+		t.Errorf("Failed to reveal and chord cell A1: %s", err)
+	}
+
+	for _, cellName := range []CellName{"A1", "B1", "A2"} {
+		coord, _ := cellNameToCoordinate(cellName)
+		if !g.grid[coord[1]][coord[0]].isRevealed {
+			t.Errorf("Failed to reveal cell %s", cellName)
+		}
+	}
+
+	if g.grid[1][1].isRevealed {
+		t.Error("Incorrectly revealed flagged cell B2")
+	}
+
+	// An unsatisfied number is only revealed.
+	err = g.RevealThenChord("C1")
+	if err != nil {
+		t.Errorf("Failed to reveal cell C1: %s", err)
+	}
+
+	if g.grid[0][3].isRevealed {
+		t.Error("Incorrectly chorded cell C1 without enough flags")
+	}
+
+	// The usual errors still apply.
+	err = g.RevealThenChord("Z30")
+	if err == nil {
+		t.Errorf("Failed to detect non-existent cell")
+	}
+}
+
+func TestUndoMove(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	err := g.UndoMove()
+	if err == nil {
+		t.Error("Failed to detect that there are no moves to undo")
+	}
+
+	g.FlagCell("D1")
+	g.RevealCell("E3")
+
+	// Undoing the reveal should take back its whole cascade, but leave the flag.
+	err = g.UndoMove()
+	if err != nil {
+		t.Errorf("Failed to undo the reveal of E3: %s", err)
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isRevealed {
+			t.Errorf("Cell %s should no longer be revealed", c)
+		}
+	})
+
+	if !g.grid[0][3].isFlagged {
+		t.Error("Undoing the reveal should leave D1 flagged")
+	}
+
+	if len(g.events) != 2 || g.version != 2 {
+		t.Errorf("Expected 2 events at version 2 after undo (found %d at version %d)", len(g.events), g.version)
+	}
+
+	// Stepping on a mine can be undone too.
+	g.RevealCell("B2")
+	g.UndoMove()
+	if g.isEnded {
+		t.Error("Undoing the losing move should resume the game")
+	}
+
+	if g.RemainingSafeCells() != 20 || g.MinesRemaining() != 4 {
+		t.Errorf("Counters weren't restored by undo (%d safe cells, %d mines remaining)", g.RemainingSafeCells(), g.MinesRemaining())
+	}
+}
+
+func TestNewGameFromLayout(t *testing.T) {
+	g, err := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error building game from layout: %s", err)
+	}
+
+	if g.mineCount != 5 {
+		t.Errorf("Game should have 5 mines (has %d)", g.mineCount)
+	}
+
+	// The layout matches the example grid, so mines and counts should too.
+	expected := makeExampleGrid()
+	g.forEachCell(func(c coordinate, target *cell) {
+		want := expected[c[1]][c[0]]
+		if target.isMined != want.isMined {
+			t.Errorf("Cell %s should have isMined %t", coordinateToCellName(c), want.isMined)
+		}
+		if !want.isMined && target.adjacentMines != want.adjacentMines {
+			t.Errorf("Cell %s should have %d adjacent mines (has %d)", coordinateToCellName(c), want.adjacentMines, target.adjacentMines)
+		}
+	})
+
+	// Mines must be within the grid.
+	_, err = NewGameFromLayout([]CellName{"A1", "F1"}, 5, 5)
+	if err == nil {
+		t.Error("Failed to detect a mine outside the grid")
+	}
+
+	// Each cell can only be mined once, however it's written.
+	_, err = NewGameFromLayout([]CellName{"A1", "C3", "A1"}, 5, 5)
+	if err == nil || err.Error() != "Cell A1 is mined more than once." {
+		t.Errorf("Failed to detect a cell mined twice (found %v)", err)
+	}
+
+	_, err = NewGameFromLayout([]CellName{"C3", "c-3"}, 5, 5)
+	if err == nil || err.Error() != "Cell c-3 is mined more than once." {
+		t.Errorf("Failed to detect a cell mined twice under another name (found %v)", err)
+	}
+}
+
+func TestNewGameNonSquare(t *testing.T) {
+	// Mines are placed at random, so try a few times to hit cells outside the square.
+	for i := 0; i < 20; i++ {
+		g, err := NewGame(3, 8, 20)
+		if err != nil {
+			t.Fatalf("Unexpected error generating game: %s", err)
+		}
+
+		if len(g.grid) != 8 || len(g.grid[0]) != 3 {
+			t.Fatalf("Game grid should be 3 wide and 8 tall (is %d wide and %d tall)", len(g.grid[0]), len(g.grid))
+		}
+
+		if g.mineCount != 20 {
+			t.Errorf("Game grid has incorrect number of mines (expected 20, found %d)", g.mineCount)
+		}
+	}
+}
+
+func TestCompactCascades(t *testing.T) {
+	compact, _ := NewGameWithOptions(5, 5, 5, Options{CompactCascades: true})
+	event := compact.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	compact.events[0] = event
+	event.applyTo(compact)
+
+	expanded, _ := NewGame(5, 5, 5)
+	expanded.events[0] = event
+	event.applyTo(expanded)
+
+	compact.RevealCell("E3")
+	expanded.RevealCell("E3")
+
+	// The whole cascade should be a single event.
+	if len(compact.events) != 2 {
+		t.Fatalf("Expected the started event plus one compacted reveal (found %d events)", len(compact.events))
+	}
+
+	revealed, ok := compact.events[1].(cellsRevealedEvent)
+	if !ok {
+		t.Fatalf("Expected a cellsRevealedEvent (found %T)", compact.events[1])
+	}
+
+	if len(revealed.CellCoords) != 9 || revealed.InteractionCellName != "E3" {
+		t.Errorf("Expected 9 cells revealed by clicking E3 (found %d by clicking %s)", len(revealed.CellCoords), revealed.InteractionCellName)
+	}
+
+	// Replaying the compacted log gives the same grid as the expanded one.
+	replayed := &game{}
+	replayed.replay(compact.events)
+
+	for _, g := range []*game{compact, replayed} {
+		g.forEachCell(func(c coordinate, target *cell) {
+			if target.isRevealed != expanded.grid[c[1]][c[0]].isRevealed {
+				t.Errorf("Cell %s should have isRevealed %t", c, expanded.grid[c[1]][c[0]].isRevealed)
+			}
+		})
+
+		if g.RemainingSafeCells() != expanded.RemainingSafeCells() {
+			t.Errorf("Expected %d safe cells remaining (found %d)", expanded.RemainingSafeCells(), g.RemainingSafeCells())
+		}
+	}
+}
+
+func TestEmptyGrid(t *testing.T) {
+	empty := gameStartedEvent{grid: [][]cell{}}
+
+	// Replaying should refuse the empty grid.
+	g := &game{}
+	err := g.replay([]event{empty})
+	if err == nil {
+		t.Error("Failed to detect an empty grid while replaying")
+	}
+
+	// Applying the event directly shouldn't panic, and leaves nothing to play.
+	empty.applyTo(g)
+	err = g.RevealCell("A1")
+	if err == nil {
+		t.Error("Failed to detect revealing a cell in an empty grid")
+	}
+
+	err = g.FlagCell("A1")
+	if err == nil {
+		t.Error("Failed to detect flagging a cell in an empty grid")
+	}
+
+	if s := g.Snapshot(); s.Width != 0 || s.Height != 0 {
+		t.Errorf("Expected an empty snapshot (found %dx%d)", s.Width, s.Height)
+	}
+}
+
+func TestEventChannel(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Collect everything streamed until the channel is closed.
+	ch := g.EventChannel()
+	done := make(chan []EventRecord)
+	go func() {
+		received := []EventRecord{}
+		for r := range ch {
+			received = append(received, r)
+		}
+		done <- received
+	}()
+
+	g.RevealCell("E3")
+	g.Close()
+	received := <-done
+
+	if len(received) != len(g.events)-1 {
+		t.Fatalf("Expected %d streamed events (received %d)", len(g.events)-1, len(received))
+	}
+
+	for i, r := range received {
+		expected := recordOf(g.events[i+1])
+		if r.Type != expected.Type || r.Version != expected.Version || r.Cell != expected.Cell {
+			t.Errorf("Streamed event %d should be %+v (is %+v)", i, expected, r)
+		}
+	}
+}
+
+func TestEventChannelAfterUndo(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	ch := g.EventChannel()
+	g.RevealCell("A1")
+	g.UndoMove()
+	g.RevealCell("E1")
+	g.Reset()
+	g.Close()
+
+	// Undoing and resetting send the log again from the start, so the spectator can start over.
+	received := []string{}
+	for r := range ch {
+		received = append(received, fmt.Sprintf("%s v%d %s", r.Type, r.Version, r.Cell))
+	}
+
+	expected := "[CellRevealed v2 A1 GameStarted v1  CellRevealed v2 E1 GameStarted v1 ]"
+	if fmt.Sprint(received) != expected {
+		t.Errorf("Expected the spectator to be sent %s (found %v)", expected, received)
+	}
+}
+
+// The open regions are worked out when the game starts, so revealing a large one shouldn't
+// need the breadth-first search of floodFrom.
+func BenchmarkCascadeFrom(b *testing.B) {
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 40, 40)
+	for i := 0; i < b.N; i++ {
+		g.cascadeFrom(coordinate{39, 39})
+	}
+}
+
+func BenchmarkFloodFrom(b *testing.B) {
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 40, 40)
+	for i := 0; i < b.N; i++ {
+		floodFrom(g.grid, coordinate{39, 39}, Moore)
+	}
+}
+
+func TestRevealRandomSafe(t *testing.T) {
+	// The same seed and state should always pick the same cell.
+	picks := []CellName{}
+	for i := 0; i < 2; i++ {
+		g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+		g.rng = rand.New(rand.NewSource(42))
+		g.RevealCell("A1")
+
+		cellName, err := g.RevealRandomSafe()
+		if err != nil {
+			t.Fatalf("Failed to reveal a random safe cell: %s", err)
+		}
+
+		coord, _ := cellNameToCoordinate(cellName)
+		if target := g.grid[coord[1]][coord[0]]; target.isMined || !target.isRevealed {
+			t.Errorf("Expected safe cell %s to be revealed", cellName)
+		}
+
+		if g.isEnded {
+			t.Error("Revealing a random safe cell shouldn't lose the game")
+		}
+
+		picks = append(picks, cellName)
+	}
+
+	if picks[0] != picks[1] {
+		t.Errorf("Expected the same cell for the same seed (picked %s and %s)", picks[0], picks[1])
+	}
+
+	// Once the game is won, there's nothing safe left.
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 2, 2)
+	g.RevealCell("B1")
+	g.RevealCell("A2")
+	g.RevealCell("B2")
+
+	_, err := g.RevealRandomSafe()
+	if err == nil {
+		t.Error("Failed to detect that no safe cells remain")
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	useFakeClock(t, start, time.Minute)
+
+	g, _ := NewGameWithOptions(5, 5, 5, Options{MaxIdle: 10 * time.Minute})
+	if !g.ExpiresAt().Equal(start.Add(10 * time.Minute)) {
+		t.Errorf("Game should expire 10 minutes after it started (expires at %s)", g.ExpiresAt())
+	}
+
+	if g.IsExpired(start.Add(10 * time.Minute)) {
+		t.Error("Game shouldn't expire until the idle window has passed")
+	}
+
+	if !g.IsExpired(start.Add(10*time.Minute + time.Second)) {
+		t.Error("Game should expire once the idle window has passed")
+	}
+
+	// A move (a minute later, by the fake clock) resets the window.
+	g.FlagCell("A1")
+	if g.IsExpired(start.Add(10*time.Minute + time.Second)) {
+		t.Error("Game shouldn't expire so soon after a move")
+	}
+
+	if !g.IsExpired(start.Add(11*time.Minute + time.Second)) {
+		t.Error("Game should expire once the idle window after the last move has passed")
+	}
+
+	// Without a maximum, games never expire.
+	g, _ = NewGame(5, 5, 5)
+	if g.IsExpired(start.Add(24 * 365 * time.Hour)) {
+		t.Error("Game without a maximum idle time shouldn't expire")
+	}
+}
+
+func TestRevealCellResult(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		g, _ := NewGameWithOptions(5, 5, 5, Options{CompactCascades: compact})
+		event := g.events[0].(gameStartedEvent)
+		event.grid = makeExampleGrid()
+		g.events[0] = event
+		event.applyTo(g)
+
+		revealed, err := g.RevealCellResult("E3")
+		if err != nil {
+			t.Fatalf("Failed to reveal cell E3: %s", err)
+		}
+
+		// The clicked cell comes first, followed by the rest of its open region.
+		if len(revealed) == 0 || revealed[0] != "E3" {
+			t.Fatalf("Expected E3 to be revealed first (found %v)", revealed)
+		}
+
+		found := []coordinate{}
+		for _, cellName := range revealed[1:] {
+			coord, _ := cellNameToCoordinate(cellName)
+			found = append(found, coord)
+		}
+		expected := []coordinate{{2, 1}, {3, 1}, {4, 1}, {2, 2}, {3, 2}, {2, 3}, {3, 3}, {4, 3}}
+		assertEqualCoords("Should return the cells opened by the cascade", expected, found, t)
+
+		// A numbered cell only reveals itself.
+		revealed, _ = g.RevealCellResult("A1")
+		if len(revealed) != 1 || revealed[0] != "A1" {
+			t.Errorf("Expected only A1 to be revealed (found %v)", revealed)
+		}
+
+		_, err = g.RevealCellResult("A1")
+		if err == nil {
+			t.Error("Failed to detect previously revealed cell")
+		}
+	}
+}
+
+func TestOnCascade(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+		g.options.CompactCascades = compact
+
+		cascaded := []CellName{}
+		g.OnCascade(func(cellName CellName) { cascaded = append(cascaded, cellName) })
+		g.RevealCell("E3")
+
+		// E3 was clicked, so only the rest of the open region cascades.
+		if expected := "[D3 D2 D4 C3 C2 C4 E2 E4]"; fmt.Sprint(cascaded) != expected {
+			t.Errorf("Expected OnCascade to be called for %s with compact cascades %t (called for %v)", expected, compact, cascaded)
+		}
+	}
+}
+
+func TestOnWinAndOnLose(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+
+	wins := 0
+	detonated := []CellName{}
+	g.OnWin(func() { wins++ })
+	g.OnLose(func(cellName CellName) { detonated = append(detonated, cellName) })
+
+	// Chording with a misplaced flag sets off a mine.
+	g.RevealCell("A1")
+	g.FlagCell("B1")
+	g.ChordCell("A1")
+
+	if len(detonated) != 1 || detonated[0] != "B2" {
+		t.Errorf("Expected OnLose to fire once for B2 (fired for %v)", detonated)
+	}
+	if wins != 0 {
+		t.Errorf("OnWin shouldn't fire for a lost game (fired %d times)", wins)
+	}
+
+	// Undoing and replaying doesn't fire anything again.
+	g.UndoMove()
+	if len(detonated) != 1 {
+		t.Errorf("Expected OnLose not to fire again on undo (fired %d times)", len(detonated))
+	}
+
+	// Winning only fires OnWin.
+	g, _ = NewGameFromLayout([]CellName{"A1"}, 2, 2)
+	g.OnWin(func() { wins++ })
+	g.OnLose(func(cellName CellName) { detonated = append(detonated, cellName) })
+	for _, cellName := range []CellName{"B1", "A2", "B2"} {
+		g.RevealCell(cellName)
+	}
+
+	if wins != 1 {
+		t.Errorf("Expected OnWin to fire once (fired %d times)", wins)
+	}
+	if len(detonated) != 1 {
+		t.Errorf("OnLose shouldn't fire for a won game")
+	}
+}
+
+func TestSafeOpenings(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	openings := g.SafeOpenings()
+	if len(openings) != 2 || openings[0] != "D3" || openings[1] != "E3" {
+		t.Errorf("Expected openings [D3 E3] (found %v)", openings)
+	}
+
+	if len(g.events) != 1 || g.revealedOrFlaggedCellCount != 0 {
+		t.Error("Listing safe openings shouldn't change the game")
+	}
+
+	// Once play has started, there are no more hints.
+	g.RevealCell("A1")
+	if openings := g.SafeOpenings(); len(openings) != 0 {
+		t.Errorf("Expected no openings after the first reveal (found %v)", openings)
+	}
+}
+
+func TestOutOfBoundsCells(t *testing.T) {
+	// "Z99" parses fine, but is well off a small board.
+	g, _ := NewGame(3, 3, 1)
+	moves := map[string]func(CellName) error{
+		"reveal":           g.RevealCell,
+		"flag":             g.FlagCell,
+		"chord":            g.ChordCell,
+		"reveal and chord": g.RevealThenChord,
+	}
+
+	for name, move := range moves {
+		err := move("Z99")
+		if err == nil || err.Error() != "Invalid cell Z99 (25,98)." {
+			t.Errorf("Expected an out of bounds error when trying to %s Z99 (found %v)", name, err)
+		}
+	}
+
+	if len(g.events) != 1 || len(g.moves) != 0 {
+		t.Error("Moves on out of bounds cells shouldn't change the game")
+	}
+}
+
+func TestWasMine(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	if _, err := g.WasMine("D1"); err == nil {
+		t.Error("Shouldn't be able to check for mines during play")
+	}
+
+	g.RevealCell("D1")
+
+	expected := map[CellName]bool{"D1": true, "B2": true, "E5": true, "A1": false, "C3": false}
+	for cellName, isMined := range expected {
+		if found, err := g.WasMine(cellName); err != nil {
+			t.Errorf("Failed checking %s after the game ended: %s", cellName, err)
+		} else if found != isMined {
+			t.Errorf("Expected %s mined to be %t (found %t)", cellName, isMined, found)
+		}
+	}
+
+	if _, err := g.WasMine("Z99"); err == nil {
+		t.Error("Expected an error checking an out of bounds cell")
+	}
+}
+
+func TestStats(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Opens up A1, E3 and the 8 cells around it, and flags two mines.
+	g.RevealCell("A1")
+	g.RevealCell("E3")
+	g.FlagCell("D1")
+	g.FlagCell("E5")
+
+	expected := BoardStats{Revealed: 10, Flagged: 2, RemainingSafe: 10, Mines: 5, Completion: 50}
+	if stats := g.Stats(); stats != expected {
+		t.Errorf("Expected stats %+v (found %+v)", expected, stats)
+	}
+}
+
+func TestRevealFlaggedCell(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.FlagCell("B2")
+
+	err := g.RevealCell("B2")
+	if !errors.Is(err, ErrCellFlagged) {
+		t.Errorf("Expected ErrCellFlagged revealing a flagged cell (found %v)", err)
+	} else if err.Error() != "Cell is flagged. Unflag B2 before revealing it." {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+
+	if g.isEnded || g.grid[1][1].isRevealed {
+		t.Error("Revealing a flagged mine shouldn't detonate it")
+	}
+
+	// Once the flag is removed, the cell can be revealed as normal.
+	g.FlagCell("B2")
+	if err := g.RevealCell("B2"); err != nil || !g.isEnded {
+		t.Errorf("Expected revealing the unflagged mine to end the game (error %v)", err)
+	}
+}
+
+func TestRevealIdempotent(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	if err := g.RevealIdempotent("A1"); err != nil {
+		t.Fatalf("Failed revealing A1: %s", err)
+	}
+
+	// A retry does nothing, and isn't an error.
+	events := len(g.events)
+	if err := g.RevealIdempotent("A1"); err != nil {
+		t.Errorf("Expected no error revealing A1 again (found %s)", err)
+	}
+	if len(g.events) != events {
+		t.Errorf("Expected no new events revealing A1 again (found %d)", len(g.events)-events)
+	}
+
+	// Other mistakes are still errors.
+	if err := g.RevealIdempotent("Z99"); err == nil {
+		t.Error("Expected an error revealing an out of bounds cell")
+	}
+}
+
+func TestSeededGamesRunConcurrently(t *testing.T) {
+	// Work out what each seed gives on its own first.
+	mines := func(g *game) string {
+		layout := ""
+		g.forEachCell(func(c coordinate, target *cell) {
+			if target.isMined {
+				layout += string(coordinateToCellName(c))
+			}
+		})
+		return layout
+	}
+
+	seeds := []int64{1, 2}
+	expected := make([]string, len(seeds))
+	for i, seed := range seeds {
+		g, _ := NewGameWithOptions(16, 16, 40, Options{Seed: seed})
+		expected[i] = mines(g)
+	}
+
+	if expected[0] == expected[1] {
+		t.Fatal("Expected different seeds to give different layouts")
+	}
+
+	// Creating and playing many at once shouldn't change anything, as each has its own source.
+	found := make([][]string, len(seeds))
+	done := make(chan bool)
+	for i, seed := range seeds {
+		go func(i int, seed int64) {
+			for n := 0; n < 20; n++ {
+				g, _ := NewGameWithOptions(16, 16, 40, Options{Seed: seed})
+				g.RevealRandomSafe()
+				found[i] = append(found[i], mines(g))
+			}
+			done <- true
+		}(i, seed)
+	}
+	for range seeds {
+		<-done
+	}
+
+	for i := range seeds {
+		for _, layout := range found[i] {
+			if layout != expected[i] {
+				t.Errorf("Seed %d gave a different layout when run alongside another game", seeds[i])
+				break
+			}
+		}
+	}
+}
+
+func TestAdjacentMines(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+
+	if count, err := g.AdjacentMines("C2"); err != nil || count != 2 {
+		t.Errorf("Expected C2 to have 2 adjacent mines (found %d, error %v)", count, err)
+	}
+
+	if count, err := g.AdjacentMines("E3"); err != nil || count != 0 {
+		t.Errorf("Expected E3 to have no adjacent mines (found %d, error %v)", count, err)
+	}
+
+	// Nothing is given away about cells the player can't see.
+	count, err := g.AdjacentMines("A3")
+	if err == nil || err.Error() != "Cell A3 hasn't been revealed yet." || count != 0 {
+		t.Errorf("Expected an error for unrevealed A3 (found %d, error %v)", count, err)
+	}
+}
+
+func TestAdjacentFlags(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.FlagCell("B2")
+	g.FlagCell("D1")
+	g.FlagCell("A4")
+
+	if count, err := g.AdjacentFlags("C1"); err != nil || count != 2 {
+		t.Errorf("Expected C1 to have 2 adjacent flags (found %d, error %v)", count, err)
+	}
+
+	if _, err := g.AdjacentFlags("F1"); err == nil {
+		t.Error("Expected an error for cell F1, which is off the board")
+	}
+}
+
+func TestUnrevealedNeighbors(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.FlagCell("B2")
+
+	// C3's neighbors to the right were opened up by the cascade from E3.
+	neighbors, err := g.UnrevealedNeighbors("C3")
+	if err != nil || fmt.Sprint(neighbors) != "[B3 B4]" {
+		t.Errorf("Expected C3 to have unrevealed neighbors B3 and B4 (found %v, error %v)", neighbors, err)
+	}
+
+	if _, err := g.UnrevealedNeighbors("F1"); err == nil {
+		t.Error("Expected an error for cell F1, which is off the board")
+	}
+}
+
+func TestRecoverFromPanicDuringMove(t *testing.T) {
+	// A ragged grid passes the bounds check for B2, but has no cell there.
+	g := &game{grid: [][]cell{make([]cell, 2), {}}, cellCount: 4}
+	if err := g.RevealCell("B2"); !errors.Is(err, ErrInternal) {
+		t.Errorf("Expected ErrInternal revealing a missing cell (found %v)", err)
+	}
+
+	// Break a real game's grid so that the cascade from A1 falls off the end of the last row.
+	g, _ = NewGameFromLayout([]CellName{"C3"}, 3, 3)
+	g.grid[2] = g.grid[2][:1]
+
+	err := g.RevealCell("A1")
+	if !errors.Is(err, ErrInternal) {
+		t.Fatalf("Expected ErrInternal from the broken cascade (found %v)", err)
+	}
+
+	// The move is abandoned, and the game replayed from its events as they were before.
+	if len(g.events) != 1 || len(g.moves) != 0 {
+		t.Errorf("Expected the partial move to be discarded (found %d events, %d moves)", len(g.events), len(g.moves))
+	}
+
+	if g.grid[0][0].isRevealed || g.revealedSafeCount != 0 || len(g.grid[2]) != 3 {
+		t.Error("Expected the game to be back to how it started")
+	}
+}
+
+func TestReplayRejectsImpossibleEvents(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	first := len(g.events)
+
+	// D4 was opened up by the cascade from E3, so it can't be revealed again.
+	base := eventsource.BaseEvent{AggregateId: g.id, Version: g.version + 1}
+	events := append(g.events[:first:first], cellRevealedEvent{BaseEvent: base, InteractionCellName: "D4", CellCoord: coordinate{3, 3}})
+
+	expected := fmt.Sprintf("Cannot replay event %d: Cell D4 already revealed", first+1)
+	if err := (&game{}).replay(events); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q (found %v)", expected, err)
+	}
+
+	// Nor can anything happen off the board.
+	events = append(g.events[:first:first], cellFlaggedEvent{BaseEvent: base, CellCoord: coordinate{7, 7}})
+
+	expected = fmt.Sprintf("Cannot replay event %d: Invalid cell H8 (7,7).", first+1)
+	if err := (&game{}).replay(events); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q (found %v)", expected, err)
+	}
+
+	// Or before the game has started.
+	if err := (&game{}).replay(events[1:]); err == nil || err.Error() != "Cannot replay event 1: The game hasn't started." {
+		t.Errorf("Expected an error replaying without a start (found %v)", err)
+	}
+
+	// Or after it's ended, though notes can still be made.
+	g.RevealCell("D1")
+	ended := len(g.events)
+	events = append(g.events[:ended:ended], cellAnnotatedEvent{BaseEvent: base, CellCoord: coordinate{0, 0}, Note: "?"})
+	if err := (&game{}).replay(events); err != nil {
+		t.Errorf("Failed replaying a note after the game ended: %s", err)
+	}
+
+	events = append(events, cellRevealedEvent{BaseEvent: base, InteractionCellName: "A1", CellCoord: coordinate{0, 0}})
+	expected = fmt.Sprintf("Cannot replay event %d: The game has already ended.", ended+2)
+	if err := (&game{}).replay(events); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q (found %v)", expected, err)
+	}
+}
+
+func TestRevealsRecordRemainingSafeCells(t *testing.T) {
+	for _, opts := range []Options{{}, {CompactCascades: true}} {
+		g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+		g.options = opts
+		path, _ := g.SolutionPath()
+		for _, cellName := range path {
+			g.RevealCell(cellName)
+		}
+
+		// Each reveal should leave fewer safe cells than the last, down to none at the win.
+		last := g.cellCount - g.mineCount
+		for i, e := range g.events {
+			remaining := last
+			switch v := e.(type) {
+			case cellRevealedEvent:
+				remaining = v.RemainingSafe
+			case cellsRevealedEvent:
+				remaining = v.RemainingSafe
+			default:
+				continue
+			}
+
+			if remaining >= last {
+				t.Errorf("Expected fewer than %d safe cells remaining after event %d (found %d)", last, i+1, remaining)
+			}
+			last = remaining
+		}
+
+		if last != 0 || !g.isEnded {
+			t.Errorf("Expected the game to be won with no safe cells remaining (found %d)", last)
+		}
+	}
+}
+
+func TestMineMap(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	mines := g.MineMap()
+	if len(mines) != 5 || len(mines[0]) != 5 {
+		t.Fatalf("Expected a 5x5 mine map (found %dx%d)", len(mines[0]), len(mines))
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if mines[c[1]][c[0]] != target.isMined {
+			t.Errorf("Expected %s mined to be %t in the mine map", coordinateToCellName(c), target.isMined)
+		}
+	})
+
+	// It's a copy, so changing it doesn't change the game.
+	mines[0][0] = true
+	if g.grid[0][0].isMined {
+		t.Error("Changing the mine map shouldn't change the game")
+	}
+}
+
+func TestMaxCascadeEvents(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 40, 40)
+	g.options.MaxCascadeEvents = 10
+	g.RevealCell("AN40")
+
+	// The reveal itself, at most 10 for the cascade, and the win.
+	if len(g.events)-1 > 12 {
+		t.Errorf("Expected at most 12 events from the reveal (found %d)", len(g.events)-1)
+	}
+
+	if g.RemainingSafeCells() != 0 || !g.isEnded {
+		t.Errorf("Expected the cascade to reveal every safe cell and win (%d left)", g.RemainingSafeCells())
+	}
+
+	batch, ok := g.events[len(g.events)-2].(cellsRevealedEvent)
+	if !ok || batch.RemainingSafe != 0 || batch.InteractionCellName != "AN40" {
+		t.Errorf("Expected the rest of the cascade in one event (found %+v)", g.events[len(g.events)-2])
+	}
+
+	// Replaying gives the same board.
+	replayed := &game{}
+	if err := replayed.replay(g.events); err != nil {
+		t.Fatalf("Failed replaying batched cascade: %s", err)
+	}
+	assertGridsMatch("Replayed grid should match", g.grid, replayed.grid, t)
+}
+
+func TestRevealingOnlySafeCellWins(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1", "B1", "A2"}, 2, 2)
+	if err := g.RevealCell("B2"); err != nil {
+		t.Fatalf("Failed revealing the only safe cell: %s", err)
+	}
+
+	if _, won := g.events[len(g.events)-1].(gameWonEvent); !won || !g.isEnded {
+		t.Fatalf("Expected revealing the only safe cell to win (last event is %T)", g.events[len(g.events)-1])
+	}
+
+	// Nothing else can happen once the game is won.
+	events := len(g.events)
+	for name, move := range map[string]func(CellName) error{"reveal": g.RevealCell, "flag": g.FlagCell, "chord": g.ChordCell} {
+		if err := move("A1"); !errors.Is(err, ErrGameEnded) {
+			t.Errorf("Expected ErrGameEnded trying to %s after winning (found %v)", name, err)
+		}
+	}
+	if len(g.events) != events {
+		t.Error("Expected no more events after winning")
+	}
+
+	// If the win was never recorded, it's caught before a mine can be stepped on.
+	cleared := &game{}
+	cleared.replay(g.events[:len(g.events)-1])
+	if err := cleared.RevealCell("A1"); !errors.Is(err, ErrGameEnded) {
+		t.Errorf("Expected ErrGameEnded revealing on a cleared board (found %v)", err)
+	}
+
+	if _, won := cleared.events[len(cleared.events)-1].(gameWonEvent); !won || cleared.grid[0][0].isRevealed {
+		t.Error("Expected the cleared board to be won without revealing the mine")
+	}
+}
+
+func TestRevealIndex(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+
+	// Index 5 on a board 5 wide is the first cell of the second row.
+	if err := g.RevealIndex(5); err != nil {
+		t.Fatalf("Failed revealing index 5: %s", err)
+	}
+	if !g.grid[1][0].isRevealed || g.grid[0][0].isRevealed {
+		t.Error("Expected index 5 to reveal A2")
+	}
+
+	for _, i := range []int{-1, 25} {
+		if err := g.RevealIndex(i); err == nil || err.Error() != fmt.Sprintf("Invalid cell index %d. Must be between 0 and 24.", i) {
+			t.Errorf("Expected an error revealing index %d (found %v)", i, err)
+		}
+	}
+}
+
+func TestRevealCellOutcome(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 3, 2)
+	if outcome, err := g.RevealCellOutcome("B1"); err != nil || outcome != Continue {
+		t.Errorf("Expected a safe reveal to continue the game (found %d, error %v)", outcome, err)
+	}
+
+	// C1 opens up everything else but A2.
+	g.RevealCell("C1")
+	if outcome, err := g.RevealCellOutcome("A2"); err != nil || outcome != Won {
+		t.Errorf("Expected the last safe reveal to win the game (found %d, error %v)", outcome, err)
+	}
+
+	g, _ = NewGameFromLayout([]CellName{"A1"}, 3, 2)
+	if outcome, err := g.RevealCellOutcome("A1"); err != nil || outcome != Lost {
+		t.Errorf("Expected revealing a mine to lose the game (found %d, error %v)", outcome, err)
+	}
+
+	if outcome, err := g.RevealCellOutcome("C2"); err == nil || outcome != Continue {
+		t.Errorf("Expected an error revealing after the game ended (found %d, error %v)", outcome, err)
+	}
+}
+
+func TestMaxEvents(t *testing.T) {
+	layout := []CellName{"D1", "B2", "A4", "B4", "E5"}
+	g, _ := NewGameFromLayout(layout, 5, 5)
+	g.options.MaxEvents = 6
+	unlimited, _ := NewGameFromLayout(layout, 5, 5)
+
+	moves := []func(*game) error{
+		func(g *game) error { return g.RevealCell("A1") },
+		func(g *game) error { return g.FlagCell("B2") },
+		func(g *game) error { return g.UndoMove() },
+		func(g *game) error { return g.FlagCell("B2") },
+		func(g *game) error { return g.FlagCell("C5") },
+		func(g *game) error { return g.FlagCell("C5") },
+		func(g *game) error { return g.RevealCell("B1") },
+		func(g *game) error { return g.RevealCell("C1") },
+		func(g *game) error { return g.UndoMove() },
+		func(g *game) error { return g.RevealCell("C1") },
+		func(g *game) error { return g.RevealCell("A2") },
+		func(g *game) error { return g.FlagCell("D1") },
+		func(g *game) error { return g.RevealCell("E1") },
+		func(g *game) error { return g.RevealCell("E3") },
+	}
+	for i, move := range moves {
+		move(g)
+		move(unlimited)
+		if len(g.events) > 6 {
+			t.Errorf("Expected at most 6 events after move %d (found %d)", i+1, len(g.events))
+		}
+	}
+
+	if len(unlimited.events) <= 6 {
+		t.Fatalf("Expected the moves to need more than 6 events (found %d)", len(unlimited.events))
+	}
+
+	// The games only differ in their ids.
+	expected := unlimited.Snapshot()
+	expected.Id = g.id
+	if fmt.Sprint(g.Snapshot()) != fmt.Sprint(expected) {
+		t.Errorf("Expected compacting to leave the game as it was:\n%v\n%v", g.Snapshot(), expected)
+	}
+
+	// The compacted log replays to the same game, and play carries on from it.
+	replayed := &game{}
+	if err := replayed.replay(g.events); err != nil {
+		t.Fatalf("Failed replaying compacted events: %s", err)
+	}
+	if fmt.Sprint(replayed.Snapshot()) != fmt.Sprint(g.Snapshot()) {
+		t.Errorf("Expected the compacted events to replay to the same game:\n%v\n%v", replayed.Snapshot(), g.Snapshot())
+	}
+
+	if err := g.RevealCell("A3"); err != nil || g.version != unlimited.version+1 {
+		t.Errorf("Expected play to carry on after compacting (version %d, error %v)", g.version, err)
+	}
+}
+
+func TestRevealAllSafe(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+	g.FlagCell("C1")
+
+	if err := g.RevealAllSafe(); err != nil {
+		t.Fatalf("Failed revealing all safe cells: %s", err)
+	}
+
+	if _, ok := g.events[len(g.events)-1].(gameWonEvent); !ok || g.RemainingSafeCells() != 0 {
+		t.Errorf("Expected every safe cell revealed and the game won (%d left, last event %T)", g.RemainingSafeCells(), g.events[len(g.events)-1])
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isMined == target.isRevealed {
+			t.Errorf("Expected only safe cells to be revealed (found %s %+v)", coordinateToCellName(c), *target)
+		}
+	})
+
+	if !g.grid[1][1].isFlagged || g.grid[0][2].isFlagged {
+		t.Errorf("Expected flags only to be removed from safe cells")
+	}
+
+	if err := g.RevealAllSafe(); err != ErrGameEnded {
+		t.Errorf("Expected an error once the game has ended (found %v)", err)
+	}
+}
+
+func TestEditorView(t *testing.T) {
+	g, _ := NewGameWithOptions(5, 5, 5, Options{EditorMode: true})
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	expected := "[[1 1 2 -1 1] [1 -1 2 1 1] [3 3 2 0 0] [-1 -1 1 1 1] [2 2 1 1 -1]]"
+	if found := fmt.Sprint(g.EditorView()); found != expected {
+		t.Errorf("Expected the editor to see every cell's count\nExpected: %s\nFound:    %s", expected, found)
+	}
+
+	g.options.EditorMode = false
+	if view := g.EditorView(); view != nil {
+		t.Errorf("Expected no editor view in normal play (found %v)", view)
+	}
+}
+
+func TestCascadeRevealingLastSafeCellsWins(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		g, _ := NewGameFromLayout([]CellName{"A1"}, 5, 5)
+		g.options.CompactCascades = compact
+		g.RevealCell("B1")
+
+		// The cascade from E5 reveals the last safe cells after E5 itself, so the win has to be
+		// noticed once it's done.
+		g.RevealCell("E5")
+		if g.RemainingSafeCells() != 0 || !g.isEnded {
+			t.Errorf("Expected the cascade to reveal every safe cell and win (compacted: %t, %d left)", compact, g.RemainingSafeCells())
+		}
+
+		if _, ok := g.events[len(g.events)-1].(gameWonEvent); !ok {
+			t.Errorf("Expected the game to be won after the cascade (compacted: %t, last event %T)", compact, g.events[len(g.events)-1])
+		}
+
+		if last, ok := g.events[len(g.events)-2].(cellRevealedEvent); !compact && (!ok || last.CellCoord == (coordinate{4, 4})) {
+			t.Errorf("Expected the last reveal to come from the cascade (found %+v)", g.events[len(g.events)-2])
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	g, _ := NewGameWithOptions(10, 10, 15, Options{Seed: 42})
+	if g.Seed() != 42 {
+		t.Errorf("Expected the game to report seed 42 (found %d)", g.Seed())
+	}
+
+	// A seed picked at random is reported too, and plays the same board again.
+	random, _ := NewGame(10, 10, 15)
+	if random.Seed() == 0 {
+		t.Fatal("Expected a game with a random seed to report the seed it picked")
+	}
+
+	again, _ := NewGameWithOptions(10, 10, 15, Options{Seed: random.Seed()})
+	if fmt.Sprint(again.MineMap()) != fmt.Sprint(random.MineMap()) {
+		t.Errorf("Expected seed %d to give the same board again", random.Seed())
+	}
+
+	layout, _ := NewGameFromLayout([]CellName{"A1"}, 5, 5)
+	if layout.Seed() != 0 {
+		t.Errorf("Expected no seed for a game from a layout (found %d)", layout.Seed())
+	}
+}
+
+func TestNewSymmetricGame(t *testing.T) {
+	g, err := NewSymmetricGame(9, 9, 10, HorizontalSymmetry, Options{Seed: 42})
+	if err != nil {
+		t.Fatalf("Failed creating a symmetric game: %s", err)
+	}
+
+	mines := g.MineMap()
+	for y := range mines {
+		for x := range mines[y] {
+			if mines[y][x] != mines[8-y][x] {
+				t.Errorf("Expected the mines to be mirrored top to bottom (%d,%d)", x, y)
+			}
+		}
+	}
+
+	if g.mineCount != 10 {
+		t.Errorf("Expected 10 mines (found %d)", g.mineCount)
+	}
+
+	// The seed is kept, and plays the same board again.
+	again, _ := NewSymmetricGame(9, 9, 10, HorizontalSymmetry, Options{Seed: g.Seed()})
+	if g.Seed() != 42 || !gridsEqual(g.grid, again.grid) {
+		t.Errorf("Expected seed 42 to give the same board again (found seed %d)", g.Seed())
+	}
+
+	if _, err := NewSymmetricGame(8, 8, 9, VerticalSymmetry, Options{}); err == nil {
+		t.Error("Expected an error for an odd mine count with no cells on the axis")
+	}
+
+	if _, err := NewSymmetricGame(8, 9, 10, DiagonalSymmetry, Options{}); err == nil {
+		t.Error("Expected an error for diagonal symmetry on a board which isn't square")
+	}
+}
+
+func TestMovesBeforeGameStarted(t *testing.T) {
+	g := &game{}
+	moves := map[string]func() error{
+		"RevealCell":    func() error { return g.RevealCell("A1") },
+		"FlagCell":      func() error { return g.FlagCell("A1") },
+		"ChordCell":     func() error { return g.ChordCell("A1") },
+		"DefuseCell":    func() error { return g.DefuseCell("A1") },
+		"AnnotateCell":  func() error { return g.AnnotateCell("A1", "?") },
+		"RevealAllSafe": func() error { return g.RevealAllSafe() },
+		"RevealIndex":   func() error { return g.RevealIndex(0) },
+	}
+
+	for name, move := range moves {
+		if err := move(); err != ErrGameNotStarted {
+			t.Errorf("Expected %s to fail on a game which hasn't started (found %v)", name, err)
+		}
+	}
+
+	if len(g.events) != 0 || g.isEnded {
+		t.Errorf("Expected nothing to happen to a game which hasn't started")
+	}
+}
+
+func TestLastActivity(t *testing.T) {
+	start := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	useFakeClock(t, start, time.Minute)
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	if !g.LastActivity().Equal(start) {
+		t.Errorf("Expected the last activity to be when the game was created (found %s)", g.LastActivity())
+	}
+
+	g.RevealCell("A1")
+	if !g.LastActivity().Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the last activity to be the reveal a minute later (found %s)", g.LastActivity())
+	}
+}
+
+func TestCascadeStopsAtFlags(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		g, _ := NewGameFromLayout([]CellName{"A1"}, 5, 5)
+		g.options.CompactCascades = compact
+
+		// A flag inside the open region isn't revealed, and a wall of them cuts it in two.
+		for _, cellName := range []CellName{"E1", "C1", "C2", "C3", "C4", "C5"} {
+			g.FlagCell(cellName)
+		}
+		g.RevealCell("E5")
+
+		g.forEachCell(func(c coordinate, target *cell) {
+			if expected := c[0] > 2 && c != (coordinate{4, 0}); target.isRevealed != expected {
+				t.Errorf("Expected %s revealed to be %t (compacted: %t)", coordinateToCellName(c), expected, compact)
+			}
+		})
+
+		if !g.grid[0][4].isFlagged || g.revealedOrFlaggedCellCount != 15 {
+			t.Errorf("Expected flags to be left as they were (compacted: %t, %d revealed or flagged)", compact, g.revealedOrFlaggedCellCount)
+		}
+	}
+}
+
+func TestUndoMovesAndRedo(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	afterFirst := fmt.Sprint(g.Snapshot())
+	g.FlagCell("B2")
+	g.RevealCell("E3")
+	afterThird := fmt.Sprint(g.Snapshot())
+
+	if err := g.UndoMoves(4); err == nil {
+		t.Error("Expected an error undoing more moves than have been made")
+	}
+
+	if err := g.UndoMoves(2); err != nil {
+		t.Fatalf("Failed undoing 2 moves: %s", err)
+	}
+	if found := fmt.Sprint(g.Snapshot()); found != afterFirst {
+		t.Errorf("Expected the game to be as it was after the first move\nExpected: %s\nFound:    %s", afterFirst, found)
+	}
+
+	// Both undone moves can be redone, most recently undone first.
+	for i := 0; i < 2; i++ {
+		if err := g.RedoMove(); err != nil {
+			t.Fatalf("Failed redoing move %d: %s", i+1, err)
+		}
+	}
+	if found := fmt.Sprint(g.Snapshot()); found != afterThird {
+		t.Errorf("Expected the game to be as it was after the third move\nExpected: %s\nFound:    %s", afterThird, found)
+	}
+
+	// A new move means nothing undone can be redone.
+	g.UndoMove()
+	g.FlagCell("A4")
+	if err := g.RedoMove(); err == nil || err.Error() != "No moves to redo." {
+		t.Errorf("Expected no moves to redo after a new move (found %v)", err)
+	}
+}
+
+func TestAnnotationsAreNotMoves(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+	g.AnnotateCell("C3", "safe?")
+
+	// Undoing takes back the flag, not the note made after it.
+	if err := g.UndoMove(); err != nil || g.grid[1][1].isFlagged || g.notes[coordinate{2, 2}] != "safe?" {
+		t.Errorf("Expected the flag to be undone and the note kept (error %v)", err)
+	}
+
+	// A note doesn't stop the flag being redone, which then follows on from it.
+	g.AnnotateCell("E3", "mine?")
+	if err := g.RedoMove(); err != nil || !g.grid[1][1].isFlagged {
+		t.Errorf("Expected the flag to be redone after a note (error %v)", err)
+	}
+
+	for i, e := range g.events {
+		if version := recordOf(e).Version; version != i+1 {
+			t.Errorf("Expected event %d to have version %d (found %d)", i+1, i+1, version)
+		}
+	}
+
+	if len(g.notes) != 2 || len(g.moves) != 2 {
+		t.Errorf("Expected 2 notes and 2 moves (found %d and %d)", len(g.notes), len(g.moves))
+	}
+}
+
+func TestRecords(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.FlagCell("B2")
+	g.RevealCell("D1")
+
+	if records := g.Records(0); len(records) != 4 || records[0].Type != "GameStarted" {
+		t.Errorf("Expected a record of all 4 events, starting with the start (found %+v)", records)
+	}
+
+	records := g.Records(2)
+	if len(records) != 2 || records[0].Type != "CellRevealed" || records[1].Type != "GameLost" {
+		t.Errorf("Expected records of the reveal and loss after version 2 (found %+v)", records)
+	}
+
+	if !g.IsComplete() {
+		t.Error("Expected the game to be complete once it's lost")
+	}
+}
+
+func TestUnflaggedMines(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1", "C1"}, 3, 3)
+	g.FlagCell("A1")
+	g.FlagCell("B3")
+	g.RevealCell("C1")
+
+	// The misplaced flag on B3 makes MinesRemaining zero, but C1 is still unflagged.
+	if found := g.UnflaggedMines(); found != 1 || g.MinesRemaining() != 0 {
+		t.Errorf("Expected 1 unflagged mine after the game ended (found %d, %d remaining)", found, g.MinesRemaining())
+	}
+}
+
+func TestFlagAllMinesWinCondition(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1", "C3"}, 3, 3)
+	g.options.WinCondition = FlagAllMines
+
+	// A misplaced flag means flagging every mine isn't enough.
+	g.FlagCell("B2")
+	g.FlagCell("A1")
+	g.FlagCell("C3")
+	if g.isEnded {
+		t.Fatal("Expected no win with a flag on a safe cell")
+	}
+
+	g.FlagCell("B2")
+	if !g.isEnded || !g.Snapshot().IsWon {
+		t.Error("Expected a win once only the mines are flagged")
+	}
+
+	if _, ok := g.events[len(g.events)-1].(gameWonEvent); !ok {
+		t.Errorf("Expected the game to be won after the last flag (last event %T)", g.events[len(g.events)-1])
+	}
+
+	// Revealing every safe cell isn't enough either.
+	g, _ = NewGameFromLayout([]CellName{"A1", "C3"}, 3, 3)
+	g.options.WinCondition = FlagAllMines
+	g.RevealAllSafe()
+	if g.isEnded {
+		t.Error("Expected no win from revealing every safe cell")
+	}
+}
+
+func TestRevealedCountsSplitByCascade(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		g, _ := NewGameFromLayout([]CellName{"A1", "D1"}, 4, 4)
+		g.options.CompactCascades = compact
+		g.RevealCell("D4")
+		g.RevealCell("B1")
+
+		if g.UserRevealedCount() != 2 || g.CascadeRevealedCount() != 11 {
+			t.Errorf("Expected 2 cells revealed directly and 11 by cascade with compact cascades %t (found %d and %d)", compact, g.UserRevealedCount(), g.CascadeRevealedCount())
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	fresh := g.Snapshot()
+
+	g.RevealCell("E3")
+	g.FlagCell("D1")
+	g.RevealCell("A1")
+	if err := g.Reset(); err != nil {
+		t.Fatalf("Unexpected error resetting: %s", err)
+	}
+
+	if reset := g.Snapshot(); !SnapshotsEqual(fresh, reset) || reset.Version != fresh.Version {
+		t.Errorf("Expected the game to be as it started after a reset (found version %d)", reset.Version)
+	}
+
+	if len(g.events) != 1 || g.flagCount != 0 || g.revealedOrFlaggedCellCount != 0 || g.UserRevealedCount() != 0 {
+		t.Errorf("Expected the log and counts to be cleared (found %d events)", len(g.events))
+	}
+
+	if !gridsEqual(g.grid, g.events[0].(gameStartedEvent).grid) {
+		t.Error("Expected the same mines after a reset")
+	}
+
+	if g.UndoMove() == nil {
+		t.Error("Expected nothing to undo after a reset")
+	}
+}
+
+func TestReshuffle(t *testing.T) {
+	g, _ := NewGameWithOptions(10, 8, 15, Options{Seed: 42})
+	before := g.events[0].(gameStartedEvent).grid
+	g.RevealCell("A1")
+	g.FlagCell("J8")
+	version := g.version
+
+	if err := g.Reshuffle(); err != nil {
+		t.Fatalf("Unexpected error reshuffling: %s", err)
+	}
+
+	if len(g.grid) != 8 || len(g.grid[0]) != 10 || g.mineCount != 15 {
+		t.Errorf("Expected a 10x8 board with 15 mines (found %dx%d with %d)", len(g.grid[0]), len(g.grid), g.mineCount)
+	}
+
+	if gridsEqual(before, g.events[0].(gameStartedEvent).grid) {
+		t.Error("Expected the mines to be laid out afresh")
+	}
+
+	if len(g.events) != 1 || g.version != version+1 || g.revealedOrFlaggedCellCount != 0 {
+		t.Errorf("Expected only a new start at version %d (found %d events at version %d)", version+1, len(g.events), g.version)
+	}
+
+	// The new seed plays the new board again.
+	again, _ := NewGameWithOptions(10, 8, 15, Options{Seed: g.Seed()})
+	if g.Seed() == 42 || !gridsEqual(g.grid, again.grid) {
+		t.Errorf("Expected seed %d to reproduce the reshuffled board", g.Seed())
+	}
+}
+
+func TestVerifyFlags(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	for _, cellName := range []CellName{"D1", "A1", "B4", "E4"} {
+		g.FlagCell(cellName)
+	}
+
+	correct, incorrect := g.VerifyFlags()
+	if fmt.Sprint(correct) != "[D1 B4]" || fmt.Sprint(incorrect) != "[A1 E4]" {
+		t.Errorf("Expected D1 and B4 to be correct, and A1 and E4 incorrect (found %v and %v)", correct, incorrect)
+	}
+}
+
+func TestRevealSatisfiedNumberChords(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+
+	if err := g.RevealCell("A1"); err != nil {
+		t.Fatalf("Expected revealing a satisfied number to chord it (found error %s)", err)
+	}
+
+	for _, cellName := range []CellName{"A2", "B1"} {
+		coord, _ := cellNameToCoordinate(cellName)
+		if !g.grid[coord[1]][coord[0]].isRevealed {
+			t.Errorf("Expected %s to be revealed by the chord", cellName)
+		}
+	}
+
+	// Once its neighbors are all open or flagged, there's nothing left to chord, so no move is
+	// made which undo would then take back.
+	moves, events := len(g.moves), len(g.events)
+	if err := g.RevealCell("A1"); err == nil || err.Error() != "Cell A1 already revealed" {
+		t.Errorf("Expected a number with nothing left to open to be already revealed (found %v)", err)
+	}
+	if err := g.ChordCell("A1"); err == nil || err.Error() != "Cell A1 has no unrevealed neighbors to chord" {
+		t.Errorf("Expected an error chording a number with nothing left to open (found %v)", err)
+	}
+	if len(g.moves) != moves || len(g.events) != events {
+		t.Errorf("Expected no move to be made (found %d moves and %d events, expected %d and %d)", len(g.moves), len(g.events), moves, events)
+	}
+
+	// A number which isn't satisfied is still already revealed.
+	g.RevealCell("A3")
+	if err := g.RevealCell("A3"); err == nil || err.Error() != "Cell A3 already revealed" {
+		t.Errorf("Expected an unsatisfied number to be already revealed (found %v)", err)
+	}
+}
+
+func TestWinWhenClearedDespiteMiscount(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 2, 2)
+	g.RevealCell("B1")
+	g.RevealCell("A2")
+
+	// Miscount so that the last safe cell doesn't look like the last.
+	g.revealedSafeCount--
+	g.RevealCell("B2")
+
+	if !g.isEnded || !g.isWon {
+		t.Error("Expected the game to be won once every safe cell was revealed")
+	}
+
+	if _, ok := g.events[len(g.events)-1].(gameWonEvent); !ok {
+		t.Errorf("Expected the last event to be the win (found %T)", g.events[len(g.events)-1])
+	}
+}
+
+func TestMergeEvents(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	shared := append([]event(nil), g.events...)
+	g.FlagCell("B2")
+	ahead := append([]event(nil), g.events...)
+
+	for _, logs := range [][2][]event{{shared, ahead}, {ahead, shared}} {
+		merged, err := MergeEvents(logs[0], logs[1])
+		if err != nil || len(merged) != len(ahead) {
+			t.Errorf("Expected a log which carries on from the other to be merged into it (found %d events, error %v)", len(merged), err)
+		}
+	}
+
+	// Another device flagged a different cell after A1.
+	g.UndoMove()
+	g.FlagCell("D1")
+	if _, err := MergeEvents(ahead, g.events); err == nil || err.Error() != "Cannot merge event logs. They diverge at version 3." {
+		t.Errorf("Expected the logs to diverge at version 3 (found %v)", err)
+	}
+}
+
+func TestMergeEventsWithSavedCopy(t *testing.T) {
+	useTempSaveDir(t)
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.Save()
+	g.FlagCell("B2")
+
+	// The loaded events' times lose their monotonic readings, but they're still the same events.
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game: %s", err)
+	}
+
+	merged, err := MergeEvents(g.events, loaded.events)
+	if err != nil || len(merged) != len(g.events) {
+		t.Errorf("Expected the saved copy to be merged into the log in memory (found %d events, error %v)", len(merged), err)
+	}
+}
+
+func TestLargestOpenRegion(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// D3 and E3 open up along with the 7 numbers around them.
+	if size := g.LargestOpenRegion(); size != 9 {
+		t.Errorf("Expected the largest open region to have 9 cells (found %d)", size)
+	}
+
+	// A board packed with mines has nowhere to open up.
+	g, _ = NewGameFromLayout([]CellName{"A1", "B2"}, 2, 2)
+	if size := g.LargestOpenRegion(); size != 0 {
+		t.Errorf("Expected no open region (found %d)", size)
+	}
+}
+
+func TestMoveEventsSurviveCompaction(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.options.MaxEvents = 3
+	for i := 0; i < 2; i++ {
+		g.FlagCell("A1")
+		g.FlagCell("A1")
+	}
+
+	// The log is compacted part way through the reveal, but its cells are still reported.
+	revealed, err := g.RevealCellResult("C3")
+	if err != nil || fmt.Sprint(revealed) != "[C3]" {
+		t.Errorf("Expected C3 to be revealed (found %v, error %v)", revealed, err)
+	}
+
+	records, err := Dispatch(g, FlagCommand{Cell: "A1"})
+	if err != nil || len(records) != 1 || records[0].Type != "CellFlagged" || records[0].Cell != "A1" {
+		t.Errorf("Expected a record of flagging A1 (found %v, error %v)", records, err)
+	}
+}
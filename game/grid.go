@@ -8,100 +8,381 @@ import (
 	"strings"
 )
 
-func generateGrid(width, height, mineCount int) ([][]cell, error) {
+// Column keys longer than this are rejected rather than risk overflowing. Three letters allow
+// for boards far wider than the 40 column limit.
+const maxColumnKeyLength = 3
+
+// How many times to try placing each mine away from the others, when spreading them out.
+const spreadRetries = 20
+
+// RowBase is the number of the first row in cell names: 1 by default, so the top-left cell is
+// A1, or 0 for A0. Nothing else is allowed. It's only for the names players see and type, so
+// saved games, records and exports always count from 1 and read back the same whatever it is.
+// It applies to every game, so set it once at start-up.
+var RowBase = 1
+
+// MaxCells caps how many cells a board can have, and is checked before anything is allocated
+// for it, so that a request for a huge board can't exhaust memory.
+var MaxCells = 1000000
+
+func generateGrid(width, height, mineCount int, opts Options, rng *rand.Rand) ([][]cell, error) {
+	if err := validateGridSize(width, height, mineCount); err != nil {
+		return nil, err
+	}
+
+	// Decide on where to place mines.
+	var mineCoords []coordinate
+	if opts.SpreadMines {
+		mineCoords = chooseSpreadMinePlacements(width, height, mineCount, rng)
+	} else {
+		mineCoords = chooseMinePlacements(width, height, mineCount, rng)
+	}
+
+	return layoutGrid(width, height, mineCoords, opts.Adjacency), nil
+}
+
+func validateGridSize(width, height, mineCount int) error {
+	if err := validateGridDimensions(width, height); err != nil {
+		return err
+	}
+
+	return validateMineCount(width, height, mineCount)
+}
+
+// validateGridDimensions() checks the board's size alone, e.g. before its mines are known.
+func validateGridDimensions(width, height int) error {
 	if width < 2 || height < 2 {
-		return nil, fmt.Errorf("Invalid dimensions %dx%d. Must be at least 2x2.", width, height)
+		return messageError(MessageDimensionsTooSmall, width, height)
 	}
 
-	if width > 40 || height > 40 {
-		return nil, fmt.Errorf("Invalid dimensions %dx%d. Must be at most 40x40.", width, height)
+	// Dividing rather than multiplying, so huge dimensions can't overflow.
+	if width > MaxCells/height {
+		return messageError(MessageTooManyCells, width, height, MaxCells)
 	}
 
-	if mineCount < 1 {
-		return nil, fmt.Errorf("Too few mintes (%d). Place at least 1.", mineCount)
+	if width > 40 || height > 40 {
+		return messageError(MessageDimensionsTooLarge, width, height)
 	}
 
-	if mineCount > width*height {
-		return nil, fmt.Errorf("Too many mines (%d). The mine count cannot exceed the number of cells.", mineCount)
+	return nil
+}
+
+// validateMineCount() checks there's at least one mine, and at least one safe cell, since a
+// board full of mines could never be won.
+func validateMineCount(width, height, mineCount int) error {
+	if mineCount < 1 || mineCount > width*height-1 {
+		return messageError(MessageInvalidMineCount, mineCount, width*height-1)
 	}
 
+	return nil
+}
+
+// layoutGrid() builds a grid with mines at the given coordinates, and every cell's count of
+// adjacent mines filled in.
+func layoutGrid(width, height int, mineCoords []coordinate, adjacency Adjacency) [][]cell {
 	// Create a mine-less matrix all of zeroes.
 	matrix := initEmptyGrid(width, height)
 
-	// Decide on where to place mines.
-	mineCoords := chooseMinePlacements(width, height, mineCount)
 	for _, c := range mineCoords {
-		matrix[c[0]][c[1]].isMined = true
+		matrix[c[1]][c[0]].isMined = true
+	}
+	computeAdjacency(matrix, adjacency)
+
+	return matrix
+}
 
-		// Increment all adjacent cells' mine counts.
-		if c[0] > 0 {
-			if c[1] > 0 {
-				matrix[c[0]-1][c[1]-1].adjacentMines++
+// computeAdjacency() works out every safe cell's count of adjacent mines from scratch, given
+// only where the mines are. Mined cells are left with a count of zero.
+func computeAdjacency(grid [][]cell, adjacency Adjacency) {
+	for y := range grid {
+		for x := range grid[y] {
+			grid[y][x].adjacentMines = 0
+		}
+	}
+
+	for y := range grid {
+		for x := range grid[y] {
+			if !grid[y][x].isMined {
+				continue
 			}
-			matrix[c[0]-1][c[1]].adjacentMines++
-			if c[1] < height-1 {
-				matrix[c[0]-1][c[1]+1].adjacentMines++
+
+			// Increment all adjacent safe cells' mine counts.
+			for _, n := range getNeighbors(coordinate{x, y}, len(grid[0]), len(grid), adjacency) {
+				if !grid[n[1]][n[0]].isMined {
+					grid[n[1]][n[0]].adjacentMines++
+				}
 			}
 		}
-		if c[1] > 0 {
-			matrix[c[0]][c[1]-1].adjacentMines++
+	}
+}
+
+// transposeGrid() flips a grid across its top-left to bottom-right diagonal, so that the cell
+// at x,y moves to y,x. Adjacency is unaffected, so each cell keeps its count.
+func transposeGrid(grid [][]cell) [][]cell {
+	transposed := initEmptyGrid(len(grid), len(grid[0]))
+	for y := range grid {
+		for x := range grid[y] {
+			transposed[x][y] = grid[y][x]
 		}
-		if c[1] < height-1 {
-			matrix[c[0]][c[1]+1].adjacentMines++
+	}
+
+	return transposed
+}
+
+// rotateGrid90() turns a grid a quarter turn clockwise, so a grid w wide and h tall becomes
+// h wide and w tall. Adjacency is unaffected, so each cell keeps its count.
+func rotateGrid90(grid [][]cell) [][]cell {
+	height := len(grid)
+	rotated := initEmptyGrid(height, len(grid[0]))
+	for y := range grid {
+		for x := range grid[y] {
+			rotated[x][height-1-y] = grid[y][x]
 		}
-		if c[0] < width-1 {
-			if c[1] > 0 {
-				matrix[c[0]+1][c[1]-1].adjacentMines++
-			}
-			matrix[c[0]+1][c[1]].adjacentMines++
-			if c[1] < height-1 {
-				matrix[c[0]+1][c[1]+1].adjacentMines++
+	}
+
+	return rotated
+}
+
+// gridsEqual() checks whether two grids are the same size, with every cell in the same state:
+// mined, revealed, flagged and count of adjacent mines alike.
+func gridsEqual(a, b [][]cell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for y := range a {
+		if len(a[y]) != len(b[y]) {
+			return false
+		}
+
+		for x := range a[y] {
+			if a[y][x] != b[y][x] {
+				return false
 			}
 		}
 	}
 
-	return matrix, nil
+	return true
+}
+
+// validateGrid() checks that a grid has at least one cell, and that its rows are all the
+// same width.
+func validateGrid(grid [][]cell) error {
+	if len(grid) == 0 || len(grid[0]) == 0 {
+		return fmt.Errorf("Invalid grid. Must have at least one cell.")
+	}
+
+	for y := range grid {
+		if len(grid[y]) != len(grid[0]) {
+			return fmt.Errorf("Invalid grid. Row %d has %d cells, but row 1 has %d.", y+1, len(grid[y]), len(grid[0]))
+		}
+	}
+
+	return nil
 }
 
 func initEmptyGrid(width, height int) [][]cell {
+	// Rows share a single backing array, which is far quicker to allocate for large boards.
+	cells := make([]cell, width*height)
 	matrix := make([][]cell, height)
 	for i := 0; i < height; i++ {
-		matrix[i] = make([]cell, width)
+		matrix[i] = cells[i*width : (i+1)*width : (i+1)*width]
 	}
 
 	return matrix
 }
 
-func chooseMinePlacements(width, height, mineCount int) []coordinate {
-	// Randomly choose row and column to place each mine.
-	set := make(map[coordinate]bool)
-	for ; mineCount > 0; mineCount-- {
+func chooseMinePlacements(width, height, mineCount int, rng *rand.Rand) []coordinate {
+	// Shuffle just enough of the cells to pick each mine's spot, rather than picking at random
+	// and retrying on collisions, which slows down badly on dense boards.
+	indexes := make([]int, width*height)
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	coords := make([]coordinate, mineCount)
+	for i := range coords {
+		j := i + rng.Intn(len(indexes)-i)
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+		coords[i] = coordinate{indexes[i] % width, indexes[i] / width}
+	}
+
+	return coords
+}
+
+// chooseSymmetricMinePlacements() is like chooseMinePlacements(), but every mine has a twin
+// mirrored across the axis. Cells on the axis are their own twin, and one is used up first if
+// the mine count is odd. The rest are paired off with each other, so that every choice left
+// is of two cells.
+func chooseSymmetricMinePlacements(width, height, mineCount int, axis SymmetryAxis, rng *rand.Rand) ([]coordinate, error) {
+	if axis == DiagonalSymmetry && width != height {
+		return nil, fmt.Errorf("Invalid dimensions %dx%d. Must be square to be symmetric across the diagonal.", width, height)
+	}
 
-		c := coordinate{
-			int(rand.Float32() * float32(width)),
-			int(rand.Float32() * float32(height)),
+	var onAxis [][]coordinate
+	var pairs [][]coordinate
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := coordinate{x, y}
+			twin := mirrorCoordinate(c, width, height, axis)
+			if twin == c {
+				onAxis = append(onAxis, []coordinate{c})
+			} else if twin[1] > y || (twin[1] == y && twin[0] > x) {
+				pairs = append(pairs, []coordinate{c, twin})
+			}
 		}
-		if set[c] == true {
-			mineCount++
-		} else {
-			set[c] = true
+	}
+
+	rng.Shuffle(len(onAxis), func(i, j int) {
+		onAxis[i], onAxis[j] = onAxis[j], onAxis[i]
+	})
+
+	coords := make([]coordinate, 0, mineCount)
+	if mineCount%2 == 1 {
+		if len(onAxis) == 0 {
+			return nil, fmt.Errorf("Invalid mine count %d. Must be even on a %dx%d board, which has no cells on the axis.", mineCount, width, height)
 		}
+
+		coords = append(coords, onAxis[0][0])
+		onAxis = onAxis[1:]
+	}
+
+	for i := 0; i+1 < len(onAxis); i += 2 {
+		pairs = append(pairs, []coordinate{onAxis[i][0], onAxis[i+1][0]})
 	}
 
-	coords := make([]coordinate, 0, height)
-	for k := range set {
-		coords = append(coords, k)
+	if (mineCount-len(coords))/2 > len(pairs) {
+		return nil, fmt.Errorf("Invalid mine count %d. Must be at most %d to be symmetric.", mineCount, len(coords)+2*len(pairs))
+	}
+
+	rng.Shuffle(len(pairs), func(i, j int) {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	})
+
+	for _, pair := range pairs[:(mineCount-len(coords))/2] {
+		coords = append(coords, pair...)
+	}
+
+	return coords, nil
+}
+
+// mirrorCoordinate() gives the cell opposite the given one across the axis.
+func mirrorCoordinate(c coordinate, width, height int, axis SymmetryAxis) coordinate {
+	switch axis {
+	case HorizontalSymmetry:
+		return coordinate{c[0], height - 1 - c[1]}
+	case VerticalSymmetry:
+		return coordinate{width - 1 - c[0], c[1]}
+	}
+
+	return coordinate{c[1], c[0]}
+}
+
+// openRegions() labels each connected region of cells with no adjacent mines. It returns the
+// index of the region each cell is in (or -1 for cells with adjacent mines or mines), and the
+// cells in each region along with the numbered cells bordering it.
+func openRegions(grid [][]cell, adjacency Adjacency) ([][]int, [][]coordinate) {
+	ids := make([][]int, len(grid))
+	for y := range grid {
+		ids[y] = make([]int, len(grid[y]))
+		for x := range ids[y] {
+			ids[y][x] = -1
+		}
+	}
+
+	regions := [][]coordinate{}
+	for y := range grid {
+		for x := range grid[y] {
+			if grid[y][x].isMined || grid[y][x].adjacentMines > 0 || ids[y][x] >= 0 {
+				continue
+			}
+
+			region := append([]coordinate{{x, y}}, floodFrom(grid, coordinate{x, y}, adjacency)...)
+			for _, c := range region {
+				if grid[c[1]][c[0]].adjacentMines == 0 {
+					ids[c[1]][c[0]] = len(regions)
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+
+	return ids, regions
+}
+
+// floodFrom() lists the unrevealed cells which would be opened up by revealing the given cell,
+// in the order they're found. Flagged cells are neither opened nor passed through.
+func floodFrom(grid [][]cell, coord coordinate, adjacency Adjacency) []coordinate {
+	opened := []coordinate{}
+	if grid[coord[1]][coord[0]].adjacentMines > 0 {
+		return opened
+	}
+
+	// If there are no adjacent mines, reveal neighboring cells. Repeat for any
+	// neighbor with no adjacent mines (breadth-first traversal of the graph).
+	seen := map[coordinate]bool{coord: true}
+	queue := getNeighbors(coord, len(grid[0]), len(grid), adjacency)
+	for i := 0; i < len(queue); i++ {
+		neighbor := grid[queue[i][1]][queue[i][0]]
+
+		if !neighbor.isRevealed && !neighbor.isFlagged && !neighbor.isMined && !seen[queue[i]] {
+			seen[queue[i]] = true
+			opened = append(opened, queue[i])
+
+			// If this newly revealed cell also has no adjacent mines, keep going!
+			if neighbor.adjacentMines == 0 {
+				queue = append(queue, getNeighbors(queue[i], len(grid[0]), len(grid), adjacency)...)
+			}
+		}
+	}
+
+	return opened
+}
+
+// chooseSpreadMinePlacements() is like chooseMinePlacements(), but avoids placing mines next
+// to those already placed. Each mine gets a limited number of tries to find a spot away from
+// the others before settling for any free cell, so dense boards still fill up.
+func chooseSpreadMinePlacements(width, height, mineCount int, rng *rand.Rand) []coordinate {
+	set := make(map[coordinate]bool)
+	coords := make([]coordinate, 0, mineCount)
+	for len(coords) < mineCount {
+		var c coordinate
+		for try := 0; try < spreadRetries; try++ {
+			c = coordinate{rng.Intn(width), rng.Intn(height)}
+			if !set[c] && !touchesAny(c, set, width, height) {
+				break
+			}
+		}
+
+		if !set[c] {
+			set[c] = true
+			coords = append(coords, c)
+		}
 	}
 
 	return coords
 }
 
+// touchesAny() checks whether any of the eight cells around coord are in the set. Diagonals
+// count whatever the adjacency, since mines touching corners still look clumped together.
+func touchesAny(coord coordinate, set map[coordinate]bool, width, height int) bool {
+	for _, n := range getNeighbors(coord, width, height, Moore) {
+		if set[n] {
+			return true
+		}
+	}
+
+	return false
+}
+
 // getNeighbors() will provide a list of all coordinates adjacent to the provided coordinate
 // in a grid of the given dimensions.
-func getNeighbors(coord coordinate, width, height int) []coordinate {
-	neighbors := []coordinate{}
-	xs := []int{coord[0]}
-	ys := []int{coord[1]}
+func getNeighbors(coord coordinate, width, height int, adjacency Adjacency) []coordinate {
+	// Sizing these up front keeps allocations down, as this is called for every mine when
+	// generating a grid.
+	neighbors := make([]coordinate, 0, 8)
+	xs := append(make([]int, 0, 3), coord[0])
+	ys := append(make([]int, 0, 3), coord[1])
 
 	if coord[0] > 0 {
 		xs = append(xs, coord[0]-1)
@@ -119,6 +400,10 @@ func getNeighbors(coord coordinate, width, height int) []coordinate {
 	for _, x := range xs {
 		for _, y := range ys {
 			c := coordinate{x, y}
+			if adjacency == VonNeumann && x != coord[0] && y != coord[1] {
+				continue
+			}
+
 			if c != coord {
 				neighbors = append(neighbors, c)
 			}
@@ -128,14 +413,61 @@ func getNeighbors(coord coordinate, width, height int) []coordinate {
 	return neighbors
 }
 
+// getNeighborsOrdered() is like getNeighbors(), but lists the neighbors in reading order: left
+// to right along the row above, then the same row, then the row below.
+func getNeighborsOrdered(coord coordinate, width, height int, adjacency Adjacency) []coordinate {
+	neighbors := make([]coordinate, 0, 8)
+	for y := coord[1] - 1; y <= coord[1]+1; y++ {
+		for x := coord[0] - 1; x <= coord[0]+1; x++ {
+			if x < 0 || x >= width || y < 0 || y >= height || (x == coord[0] && y == coord[1]) {
+				continue
+			}
+
+			if adjacency == VonNeumann && x != coord[0] && y != coord[1] {
+				continue
+			}
+
+			neighbors = append(neighbors, coordinate{x, y})
+		}
+	}
+
+	return neighbors
+}
+
 func cellNameToCoordinate(cellName CellName) (coordinate, error) {
+	if RowBase != 0 && RowBase != 1 {
+		return [2]int{0, 0}, fmt.Errorf("Invalid RowBase %d. Must be 0 or 1.", RowBase)
+	}
+
+	return parseCellName(cellName, RowBase)
+}
+
+// parseCellName() is like cellNameToCoordinate(), but with rows numbered from rowBase.
+func parseCellName(cellName CellName, rowBase int) (coordinate, error) {
+	// A single separator is allowed, but dropped so the name is read as the canonical A1.
+	name := string(cellName)
+	if separated := separatedCellName.FindStringSubmatch(name); separated != nil {
+		name = separated[1] + separated[2]
+	}
+
 	// Must be letters followed by numbers.
-	matches := validCellName.FindStringSubmatch(string(cellName))
+	matches := validCellName.FindStringSubmatch(name)
 	if matches == nil {
+		if reversed := reversedCellName.FindStringSubmatch(string(cellName)); reversed != nil {
+			return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s'. The letter comes first: did you mean %s%s?", cellName, strings.ToUpper(reversed[2]), reversed[1])
+		}
+
+		if columnOnlyCellName.MatchString(string(cellName)) {
+			return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s'. Missing the row number: did you mean %s%d?", cellName, strings.ToUpper(string(cellName)), rowBase)
+		}
+
 		return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s'. Must be a letter followed by a number, e.g., B6.", cellName)
 	}
 
-	// Convert letter to x
+	// Convert letter to x, so long as it's short enough not to overflow.
+	if len(matches[1]) > maxColumnKeyLength {
+		return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s'. The column can be at most %d letters.", cellName, maxColumnKeyLength)
+	}
 	x := columnKeyToInt(matches[1])
 
 	// Convert number to y
@@ -143,7 +475,11 @@ func cellNameToCoordinate(cellName CellName) (coordinate, error) {
 	if err != nil {
 		return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s': %s", cellName, err)
 	}
-	y--
+
+	y -= rowBase
+	if y < 0 {
+		return [2]int{0, 0}, fmt.Errorf("Invalid cell name '%s'. Rows start at %d.", cellName, rowBase)
+	}
 
 	return [2]int{x, y}, nil
 }
@@ -164,8 +500,63 @@ func columnKeyToInt(columnKey string) int {
 	return x - 1
 }
 
+func coordinateToCellName(coord coordinate) CellName {
+	return CellName(fmt.Sprintf("%s%d", intToColumnKey(coord[0]), coord[1]+RowBase))
+}
+
+// savedCellName() names a cell for saving, counting rows from 1 whatever RowBase is.
+func savedCellName(coord coordinate) CellName {
+	return CellName(fmt.Sprintf("%s%d", intToColumnKey(coord[0]), coord[1]+1))
+}
+
+// parseSavedCellName() reads a cell name written by savedCellName().
+func parseSavedCellName(cellName CellName) (coordinate, error) {
+	return parseCellName(cellName, 1)
+}
+
+// savedInteraction() converts the name of a clicked cell, as the player gave it, to the form
+// it's saved in. Names which don't parse are kept as they are.
+func savedInteraction(cellName CellName) CellName {
+	if coord, err := cellNameToCoordinate(cellName); err == nil {
+		return savedCellName(coord)
+	}
+
+	return cellName
+}
+
+// loadedInteraction() is the inverse of savedInteraction().
+func loadedInteraction(cellName CellName) CellName {
+	if coord, err := parseSavedCellName(cellName); err == nil {
+		return coordinateToCellName(coord)
+	}
+
+	return cellName
+}
+
+// intToColumnKey() is the inverse of columnKeyToInt(), converting e.g. 26 to AA.
+func intToColumnKey(x int) string {
+	key := ""
+	for x++; x > 0; x = (x - 1) / 26 {
+		key = string(rune('A'+(x-1)%26)) + key
+	}
+
+	return key
+}
+
+// ColumnHeaders gives the keys of a board's columns, left to right, rolling over from Z to AA
+// on boards wider than 26.
+func ColumnHeaders(width int) []string {
+	headers := make([]string, width)
+	for x := range headers {
+		headers[x] = intToColumnKey(x)
+	}
+
+	return headers
+}
+
 func containsCoordinate(coord coordinate, grid [][]cell) bool {
-	return coord[0] >= 0 &&
+	return len(grid) > 0 &&
+		coord[0] >= 0 &&
 		coord[0] < len(grid[0]) &&
 		coord[1] >= 0 &&
 		coord[1] < len(grid)
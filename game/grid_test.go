@@ -1,12 +1,15 @@
 package game
 
 import (
+  "fmt"
+  "math"
+  "math/rand"
   "testing"
 )
 
 func TestGetNeighbors(t *testing.T) {
   // Top-left corner
-  neighbors := getNeighbors(coordinate{0, 0}, 5, 5)
+  neighbors := getNeighbors(coordinate{0, 0}, 5, 5, Moore)
   expected := []coordinate{
     {1, 0},
     {0, 1},
@@ -15,7 +18,7 @@ func TestGetNeighbors(t *testing.T) {
   assertEqualCoords("Should get neighbors for top-left cell", expected, neighbors, t)
 
   // Top-right corner
-  neighbors = getNeighbors(coordinate{4, 0}, 5, 5)
+  neighbors = getNeighbors(coordinate{4, 0}, 5, 5, Moore)
   expected = []coordinate{
     {3, 0},
     {3, 1},
@@ -24,7 +27,7 @@ func TestGetNeighbors(t *testing.T) {
   assertEqualCoords("Should get neighbors for top-right cell", expected, neighbors, t)
 
   // Bottom-left corner
-  neighbors = getNeighbors(coordinate{0, 4}, 5, 5)
+  neighbors = getNeighbors(coordinate{0, 4}, 5, 5, Moore)
   expected = []coordinate{
     {0, 3},
     {1, 3},
@@ -33,7 +36,7 @@ func TestGetNeighbors(t *testing.T) {
   assertEqualCoords("Should get neighbors for bottom-left cell", expected, neighbors, t)
 
   // Bottom-right corner
-  neighbors = getNeighbors(coordinate{4, 4}, 5, 5)
+  neighbors = getNeighbors(coordinate{4, 4}, 5, 5, Moore)
   expected = []coordinate{
     {3, 3},
     {4, 3},
@@ -42,7 +45,7 @@ func TestGetNeighbors(t *testing.T) {
   assertEqualCoords("Should get neighbors for bottom-right cell", expected, neighbors, t)
 
   // A left side
-  neighbors = getNeighbors(coordinate{0, 2}, 5, 5)
+  neighbors = getNeighbors(coordinate{0, 2}, 5, 5, Moore)
   expected = []coordinate{
     {0, 1},
     {1, 1},
@@ -53,7 +56,7 @@ func TestGetNeighbors(t *testing.T) {
   assertEqualCoords("Should get neighbors for a left side cell", expected, neighbors, t)
 
   // Somewhere in the middle
-  neighbors = getNeighbors(coordinate{2, 2}, 5, 5)
+  neighbors = getNeighbors(coordinate{2, 2}, 5, 5, Moore)
   expected = []coordinate{
     {1, 1},
     {2, 1},
@@ -114,3 +117,378 @@ func TestCellNameToCoord(t *testing.T) {
     t.Errorf("Expected 1,1 for cell name b2, got %d,%d", coord[0], coord[1])
   }
 }
+
+func TestCellNameToCoordWithSeparators(t *testing.T) {
+  for _, cellName := range []CellName{"A-1", "A 1", "A.1"} {
+    coord, err := cellNameToCoordinate(cellName)
+    if err != nil {
+      t.Errorf("Failed converting cell name %s: %s", cellName, err)
+    } else if coord[0] != 0 || coord[1] != 0 {
+      t.Errorf("Expected 0,0 for cell name %s, got %d,%d", cellName, coord[0], coord[1])
+    }
+  }
+
+  for _, cellName := range []CellName{"A--1", "A-", "A-1-"} {
+    if _, err := cellNameToCoordinate(cellName); err == nil {
+      t.Errorf("Expected an error converting cell name %s", cellName)
+    }
+  }
+}
+
+func TestCoordinateToCellName(t *testing.T) {
+  cellName := coordinateToCellName(coordinate{0, 0})
+  if cellName != "A1" {
+    t.Errorf("Expected A1 for 0,0, got %s", cellName)
+  }
+
+  cellName = coordinateToCellName(coordinate{77, 9})
+  if cellName != "BZ10" {
+    t.Errorf("Expected BZ10 for 77,9, got %s", cellName)
+  }
+
+  for x := 0; x < 100; x++ {
+    if i := columnKeyToInt(intToColumnKey(x)); i != x {
+      t.Errorf("Column key %s for %d converts back to %d", intToColumnKey(x), x, i)
+    }
+  }
+}
+
+func TestColumnHeaders(t *testing.T) {
+  headers := ColumnHeaders(30)
+  if len(headers) != 30 || headers[0] != "A" || headers[25] != "Z" || headers[26] != "AA" || headers[29] != "AD" {
+    t.Errorf("Expected A to AD for width 30, got %v", headers)
+  }
+
+  for x, header := range headers {
+    if i := columnKeyToInt(header); i != x {
+      t.Errorf("Column header %s for %d converts back to %d", header, x, i)
+    }
+  }
+}
+
+func TestOpenRegions(t *testing.T) {
+  ids, regions := openRegions(makeExampleGrid(), Moore)
+
+  // D3 and E3 are the only cells with no adjacent mines, and form one region.
+  if len(regions) != 1 {
+    t.Fatalf("Expected 1 open region, found %d", len(regions))
+  }
+
+  if ids[2][3] != 0 || ids[2][4] != 0 {
+    t.Errorf("Expected D3 and E3 to be in region 0, found %d and %d", ids[2][3], ids[2][4])
+  }
+
+  if ids[1][3] != -1 || ids[1][1] != -1 {
+    t.Errorf("Expected numbered cell D2 and mined cell B2 to be in no region, found %d and %d", ids[1][3], ids[1][1])
+  }
+
+  // The region opens up its own cells plus the numbers bordering it.
+  expected := []coordinate{
+    {2, 1}, {3, 1}, {4, 1},
+    {2, 2}, {3, 2}, {4, 2},
+    {2, 3}, {3, 3}, {4, 3},
+  }
+  assertEqualCoords("Should open the region and its border", expected, regions[0], t)
+}
+
+func TestCellNameToCoordHints(t *testing.T) {
+  expected := map[CellName]string{
+    "1A": "Invalid cell name '1A'. The letter comes first: did you mean A1?",
+    "A":  "Invalid cell name 'A'. Missing the row number: did you mean A1?",
+    "aa": "Invalid cell name 'aa'. Missing the row number: did you mean AA1?",
+    "?":  "Invalid cell name '?'. Must be a letter followed by a number, e.g., B6.",
+  }
+
+  for cellName, message := range expected {
+    _, err := cellNameToCoordinate(cellName)
+    if err == nil {
+      t.Errorf("Expected an error converting cell name %s", cellName)
+    } else if err.Error() != message {
+      t.Errorf("Expected error %q for cell name %s, got %q", message, cellName, err)
+    }
+  }
+}
+
+func TestChooseSpreadMinePlacements(t *testing.T) {
+  random := chooseMinePlacements(20, 20, 60, rand.New(rand.NewSource(7)))
+  spread := chooseSpreadMinePlacements(20, 20, 60, rand.New(rand.NewSource(7)))
+
+  if len(spread) != 60 {
+    t.Fatalf("Expected 60 mines, found %d", len(spread))
+  }
+
+  if averageDistance(spread) <= averageDistance(random) {
+    t.Errorf("Expected spread mines to be further apart than random ones (%.2f vs %.2f)", averageDistance(spread), averageDistance(random))
+  }
+
+  // A dense board can't avoid neighboring mines, but must still be filled.
+  spread = chooseSpreadMinePlacements(5, 5, 24, rand.New(rand.NewSource(7)))
+  if len(spread) != 24 {
+    t.Errorf("Expected 24 mines on a dense board, found %d", len(spread))
+  }
+}
+
+func averageDistance(coords []coordinate) float64 {
+  total, pairs := 0.0, 0
+  for i := range coords {
+    for j := i + 1; j < len(coords); j++ {
+      dx, dy := float64(coords[i][0]-coords[j][0]), float64(coords[i][1]-coords[j][1])
+      total += math.Sqrt(dx*dx + dy*dy)
+      pairs++
+    }
+  }
+
+  return total / float64(pairs)
+}
+
+func TestCellNameToCoordRejectsLongColumns(t *testing.T) {
+  _, err := cellNameToCoordinate("ABCDEFGHIJKLMNO1")
+  if err == nil {
+    t.Error("Expected an error for a 15 letter column")
+  }
+
+  coord, err := cellNameToCoordinate("ZZZ1")
+  if err != nil {
+    t.Errorf("Failed converting cell name ZZZ1: %s", err)
+  } else if coord[0] != 18277 {
+    t.Errorf("Expected column 18277 for ZZZ1, got %d", coord[0])
+  }
+}
+
+func TestTransposeAndRotateGrid(t *testing.T) {
+  // A grid 2 wide and 3 tall, with mines at A1 and B3:
+  // X  1
+  // 1  1
+  // 1  X
+  grid := layoutGrid(2, 3, []coordinate{{0, 0}, {1, 2}}, Moore)
+
+  rotated := rotateGrid90(grid)
+  if len(rotated) != 2 || len(rotated[0]) != 3 {
+    t.Fatalf("Expected rotated grid to be 3 wide and 2 tall, got %d wide and %d tall", len(rotated[0]), len(rotated))
+  }
+  assertGridsMatch("Should rotate mines clockwise", layoutGrid(3, 2, []coordinate{{2, 0}, {0, 1}}, Moore), rotated, t)
+
+  transposed := transposeGrid(grid)
+  if len(transposed) != 2 || len(transposed[0]) != 3 {
+    t.Fatalf("Expected transposed grid to be 3 wide and 2 tall, got %d wide and %d tall", len(transposed[0]), len(transposed))
+  }
+  assertGridsMatch("Should transpose mines", layoutGrid(3, 2, []coordinate{{0, 0}, {2, 1}}, Moore), transposed, t)
+
+  // Four turns gets back where we started.
+  assertGridsMatch("Should rotate back to the original grid", grid, rotateGrid90(rotateGrid90(rotateGrid90(rotated))), t)
+}
+
+func assertGridsMatch(msg string, expected, found [][]cell, t *testing.T) {
+  for y := range expected {
+    for x := range expected[y] {
+      if expected[y][x] != found[y][x] {
+        t.Errorf("%s\nCell %d,%d should be %+v, found %+v", msg, x, y, expected[y][x], found[y][x])
+      }
+    }
+  }
+}
+
+// Boards over the 40x40 limit skip validation and build the grid directly, to see how
+// generation holds up if the limit is ever raised.
+func BenchmarkGenerateGrid(b *testing.B) {
+  cases := []struct {
+    width, height, mineCount int
+  }{
+    {9, 9, 10},
+    {40, 40, 160},
+    {40, 40, 1400},
+    {1000, 1000, 150000},
+    {1000, 1000, 900000},
+  }
+
+  for _, c := range cases {
+    b.Run(fmt.Sprintf("%dx%d/%d", c.width, c.height, c.mineCount), func(b *testing.B) {
+      rng := rand.New(rand.NewSource(1))
+      for i := 0; i < b.N; i++ {
+        if c.width <= 40 && c.height <= 40 {
+          generateGrid(c.width, c.height, c.mineCount, Options{}, rng)
+        } else {
+          layoutGrid(c.width, c.height, chooseMinePlacements(c.width, c.height, c.mineCount, rng), Moore)
+        }
+      }
+    })
+  }
+}
+
+func TestMaxCells(t *testing.T) {
+  // Far too big to allocate, so this only passes if it's turned down first.
+  _, err := generateGrid(1<<30, 1<<30, 10, Options{}, rand.New(rand.NewSource(1)))
+  if err == nil || err.Error() != "Invalid dimensions 1073741824x1073741824. Must have at most 1000000 cells." {
+    t.Errorf("Expected an error for a board over MaxCells, got %v", err)
+  }
+
+  original := MaxCells
+  MaxCells = 100
+  defer func() { MaxCells = original }()
+
+  if _, err := generateGrid(20, 20, 10, Options{}, rand.New(rand.NewSource(1))); err == nil {
+    t.Error("Expected an error for a 20x20 board with MaxCells lowered to 100")
+  }
+
+  if _, err := generateGrid(10, 10, 10, Options{}, rand.New(rand.NewSource(1))); err != nil {
+    t.Errorf("Failed generating a 10x10 board within MaxCells: %s", err)
+  }
+}
+
+func TestChooseSymmetricMinePlacements(t *testing.T) {
+  cases := []struct {
+    width, height, mineCount int
+    axis                     SymmetryAxis
+  }{
+    {7, 6, 11, VerticalSymmetry},
+    {6, 7, 11, HorizontalSymmetry},
+    {7, 7, 11, DiagonalSymmetry},
+    {8, 6, 12, VerticalSymmetry},
+    {3, 3, 8, VerticalSymmetry},
+  }
+
+  for _, c := range cases {
+    coords, err := chooseSymmetricMinePlacements(c.width, c.height, c.mineCount, c.axis, rand.New(rand.NewSource(3)))
+    if err != nil {
+      t.Errorf("Failed placing %d mines symmetrically on %dx%d: %s", c.mineCount, c.width, c.height, err)
+      continue
+    }
+
+    mined := make(map[coordinate]bool)
+    for _, coord := range coords {
+      mined[coord] = true
+    }
+
+    if len(mined) != c.mineCount {
+      t.Errorf("Expected %d different mines on %dx%d, found %d", c.mineCount, c.width, c.height, len(mined))
+    }
+
+    for coord := range mined {
+      if twin := mirrorCoordinate(coord, c.width, c.height, c.axis); !mined[twin] {
+        t.Errorf("Expected a mine at %s to match the one at %s on %dx%d", twin, coord, c.width, c.height)
+      }
+    }
+  }
+}
+
+func TestVonNeumannAdjacency(t *testing.T) {
+  // Only the cells directly above, below, left and right are neighbors.
+  neighbors := getNeighbors(coordinate{2, 2}, 5, 5, VonNeumann)
+  assertEqualCoords("Center cell should have 4 neighbors", []coordinate{{2, 1}, {2, 3}, {1, 2}, {3, 2}}, neighbors, t)
+
+  neighbors = getNeighbors(coordinate{0, 0}, 5, 5, VonNeumann)
+  assertEqualCoords("Corner cell should have 2 neighbors", []coordinate{{0, 1}, {1, 0}}, neighbors, t)
+
+  // Safe cells' mine counts should only include those neighbors.
+  g, err := NewGameWithOptions(5, 5, 8, Options{Adjacency: VonNeumann, Seed: 3})
+  if err != nil {
+    t.Fatalf("Failed creating game: %s", err)
+  }
+  g.forEachCell(func(c coordinate, target *cell) {
+    if target.isMined {
+      return
+    }
+
+    mines := 0
+    for _, d := range []coordinate{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} {
+      x, y := c[0]+d[0], c[1]+d[1]
+      if x >= 0 && x < 5 && y >= 0 && y < 5 && g.grid[y][x].isMined {
+        mines++
+      }
+    }
+    if target.adjacentMines != mines {
+      t.Errorf("Cell %s should have %d adjacent mines, found %d", coordinateToCellName(c), mines, target.adjacentMines)
+    }
+  })
+
+  // A mine only diagonally away doesn't stop a cascade. With a mine at A1, B2 has no
+  // neighboring mines, so revealing C3 opens up everything else.
+  grid := layoutGrid(3, 3, []coordinate{{0, 0}}, VonNeumann)
+  if grid[1][1].adjacentMines != 0 {
+    t.Errorf("Expected B2 to have no adjacent mines, found %d", grid[1][1].adjacentMines)
+  }
+  if opened := floodFrom(grid, coordinate{2, 2}, VonNeumann); len(opened) != 7 {
+    t.Errorf("Expected revealing C3 to open up 7 cells, found %d: %v", len(opened), opened)
+  }
+}
+
+func TestGetNeighborsOrdered(t *testing.T) {
+  cases := []struct {
+    coord     coordinate
+    adjacency Adjacency
+    expected  []coordinate
+  }{
+    {coordinate{2, 2}, Moore, []coordinate{{1, 1}, {2, 1}, {3, 1}, {1, 2}, {3, 2}, {1, 3}, {2, 3}, {3, 3}}},
+    {coordinate{4, 0}, Moore, []coordinate{{3, 0}, {3, 1}, {4, 1}}},
+    {coordinate{2, 2}, VonNeumann, []coordinate{{2, 1}, {1, 2}, {3, 2}, {2, 3}}},
+  }
+
+  // Unlike getNeighbors, the order matters here.
+  for _, c := range cases {
+    neighbors := getNeighborsOrdered(c.coord, 5, 5, c.adjacency)
+    if fmt.Sprint(neighbors) != fmt.Sprint(c.expected) {
+      t.Errorf("Neighbors of %s should be in reading order\nExpected %s\nFound    %s", c.coord, c.expected, neighbors)
+    }
+  }
+}
+
+func TestRowBase(t *testing.T) {
+  // Rows start at 1 by default, so there's no row 0.
+  if _, err := cellNameToCoordinate("A0"); err == nil || err.Error() != "Invalid cell name 'A0'. Rows start at 1." {
+    t.Errorf("Expected an error for A0 with 1-based rows, got %v", err)
+  }
+
+  RowBase = 0
+  defer func() { RowBase = 1 }()
+
+  coord, err := cellNameToCoordinate("A0")
+  if err != nil {
+    t.Fatalf("Failed converting cell name A0 with 0-based rows: %s", err)
+  } else if coord != (coordinate{0, 0}) {
+    t.Errorf("Expected A0 to be 0,0 with 0-based rows, got %s", coord)
+  }
+
+  if name := coordinateToCellName(coordinate{1, 2}); name != "B2" {
+    t.Errorf("Expected 1,2 to be B2 with 0-based rows, got %s", name)
+  }
+
+  // Moves use the same names.
+  g, _ := NewGameFromLayout([]CellName{"D0"}, 5, 5)
+  if err := g.RevealCell("A4"); err != nil || !g.grid[4][0].isRevealed {
+    t.Errorf("Expected A4 to reveal the bottom-left cell with 0-based rows (error %v)", err)
+  }
+
+  // Only 0 and 1 make sense as bases.
+  RowBase = 2
+  if _, err := cellNameToCoordinate("A2"); err == nil || err.Error() != "Invalid RowBase 2. Must be 0 or 1." {
+    t.Errorf("Expected an error for a RowBase of 2, got %v", err)
+  }
+}
+
+func TestComputeAdjacency(t *testing.T) {
+  grid := makeExampleGrid()
+  for y := range grid {
+    for x := range grid[y] {
+      grid[y][x].adjacentMines = 0
+    }
+  }
+
+  computeAdjacency(grid, Moore)
+  assertGridsMatch("Should work out adjacent mines from the mines alone", makeExampleGrid(), grid, t)
+}
+
+func TestMessagesOverride(t *testing.T) {
+  Messages[MessageInvalidMineCount] = "Nombre de mines invalide : %d. Il en faut entre 1 et %d."
+  defer delete(Messages, MessageInvalidMineCount)
+
+  _, err := NewGame(5, 5, 0)
+  if err == nil || err.Error() != "Nombre de mines invalide : 0. Il en faut entre 1 et 24." {
+    t.Errorf("Expected the overridden message for too few mines, got %v", err)
+  }
+
+  // Messages which aren't overridden stay in English.
+  _, err = NewGame(1, 5, 1)
+  if err == nil || err.Error() != "Invalid dimensions 1x5. Must be at least 2x2." {
+    t.Errorf("Expected the English message for a board too small, got %v", err)
+  }
+}
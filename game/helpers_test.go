@@ -3,8 +3,22 @@ package game
 import (
 	"sort"
 	"testing"
+	"time"
 )
 
+// useFakeClock replaces the package clock for the duration of a test, with each call
+// advancing the time by step from start.
+func useFakeClock(t *testing.T, start time.Time, step time.Duration) {
+	now := start.Add(-step)
+	clock = func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+	t.Cleanup(func() {
+		clock = time.Now
+	})
+}
+
 func makeExampleGrid() [][]cell {
 	// 1  1  2  X  1
 	// 1  X  2  1  1
@@ -0,0 +1,34 @@
+package game
+
+import "fmt"
+
+// Keys for the messages in the catalog.
+const (
+	MessageDimensionsTooSmall = "DimensionsTooSmall"
+	MessageTooManyCells       = "TooManyCells"
+	MessageDimensionsTooLarge = "DimensionsTooLarge"
+	MessageInvalidMineCount   = "InvalidMineCount"
+)
+
+// Messages overrides the wording of errors about setting up a board, e.g. to translate them,
+// keyed by the Message constants. Each is a format string taking the same values, in the same
+// order, as the English it replaces. Any left out stay in English. Like RowBase, it applies to
+// every game, so set it once at start-up.
+var Messages = map[string]string{}
+
+var defaultMessages = map[string]string{
+	MessageDimensionsTooSmall: "Invalid dimensions %dx%d. Must be at least 2x2.",
+	MessageTooManyCells:       "Invalid dimensions %dx%d. Must have at most %d cells.",
+	MessageDimensionsTooLarge: "Invalid dimensions %dx%d. Must be at most 40x40.",
+	MessageInvalidMineCount:   "Invalid mine count %d. Must be between 1 and %d.",
+}
+
+// messageError builds the error for a message in the catalog, preferring any override.
+func messageError(key string, args ...interface{}) error {
+	format, ok := Messages[key]
+	if !ok {
+		format = defaultMessages[key]
+	}
+
+	return fmt.Errorf(format, args...)
+}
@@ -0,0 +1,120 @@
+package game
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ImportMineFile starts a game from a board in the plain text format used by other
+// minesweeper tools: a row of text per row of the board, with "." for a safe cell and "*" for
+// a mine.
+func ImportMineFile(r io.Reader) (*game, error) {
+	rows := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rows = append(rows, strings.TrimRight(scanner.Text(), "\r"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Cannot read mine file: %s", err)
+	}
+
+	// Ignore any blank lines at the end of the file.
+	for len(rows) > 0 && rows[len(rows)-1] == "" {
+		rows = rows[:len(rows)-1]
+	}
+
+	grid, err := parseMineRows(rows, Moore)
+	if err != nil {
+		return nil, err
+	}
+
+	mineCount := 0
+	for _, row := range rows {
+		mineCount += strings.Count(row, "*")
+	}
+
+	if err := validateGridSize(len(grid[0]), len(grid), mineCount); err != nil {
+		return nil, err
+	}
+
+	return startGame(grid, Options{}, newRandom(0)), nil
+}
+
+// ExportMineFile writes the board's mines in the format read by ImportMineFile. This gives
+// away the solution, so it's not for players.
+func (g *game) ExportMineFile(w io.Writer) error {
+	for _, row := range mineRows(g.grid) {
+		if _, err := io.WriteString(w, row+"\n"); err != nil {
+			return fmt.Errorf("Cannot write mine file: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Fingerprint identifies the board by its size and where its mines are, e.g. so a server can
+// spot the same puzzle being shared twice. Games on the same board share a fingerprint however
+// far each has been played.
+func (g *game) Fingerprint() string {
+	rows := mineRows(g.grid)
+	width := 0
+	if len(rows) > 0 {
+		width = len(rows[0])
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%dx%d\n%s", width, len(rows), strings.Join(rows, "\n"))))
+	return fmt.Sprintf("%x", sum)
+}
+
+// mineRows lays out a grid as rows of "." for safe cells and "*" for mines.
+func mineRows(grid [][]cell) []string {
+	rows := make([]string, len(grid))
+	for y := range grid {
+		var row strings.Builder
+		for x := range grid[y] {
+			if grid[y][x].isMined {
+				row.WriteByte('*')
+			} else {
+				row.WriteByte('.')
+			}
+		}
+		rows[y] = row.String()
+	}
+
+	return rows
+}
+
+// parseMineRows builds a grid from rows of "." for safe cells and "*" for mines. The rows may
+// come from anywhere, so their size is checked before the grid is allocated.
+func parseMineRows(rows []string, adjacency Adjacency) ([][]cell, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, fmt.Errorf("Invalid grid. Must have at least one cell.")
+	}
+
+	if err := validateGridDimensions(len(rows[0]), len(rows)); err != nil {
+		return nil, err
+	}
+
+	mineCoords := []coordinate{}
+	for y, row := range rows {
+		if len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("Invalid grid. Row %d has %d cells, but row 1 has %d.", y+1, len(row), len(rows[0]))
+		}
+
+		for x, c := range row {
+			switch c {
+			case '*':
+				mineCoords = append(mineCoords, coordinate{x, y})
+			case '.':
+			default:
+				return nil, fmt.Errorf("Invalid grid. Row %d has '%c', but cells must be '.' or '*'.", y+1, c)
+			}
+		}
+	}
+
+	return layoutGrid(len(rows[0]), len(rows), mineCoords, adjacency), nil
+}
@@ -0,0 +1,77 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportAndExportMineFile(t *testing.T) {
+	board := "...*.\n.*...\n.....\n**...\n....*\n"
+	g, err := ImportMineFile(strings.NewReader(board))
+	if err != nil {
+		t.Fatalf("Failed importing mine file: %s", err)
+	}
+
+	expected, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	assertGridsMatch("Imported board should match the example layout", expected.grid, g.grid, t)
+	if g.mineCount != 5 {
+		t.Errorf("Expected 5 mines (found %d)", g.mineCount)
+	}
+
+	var exported strings.Builder
+	if err := g.ExportMineFile(&exported); err != nil {
+		t.Fatalf("Failed exporting mine file: %s", err)
+	}
+
+	if exported.String() != board {
+		t.Errorf("Expected exported board to match the imported one\nExpected %q\nFound    %q", board, exported.String())
+	}
+
+	// Windows line endings and trailing blank lines are fine.
+	if _, err := ImportMineFile(strings.NewReader("*.\r\n..\r\n\r\n")); err != nil {
+		t.Errorf("Failed importing mine file with Windows line endings: %s", err)
+	}
+}
+
+func TestImportMineFileErrors(t *testing.T) {
+	invalid := map[string]string{
+		"...*.\n.*..\n": "Invalid grid. Row 2 has 4 cells, but row 1 has 5.",
+		"..\n.x\n":      "Invalid grid. Row 2 has 'x', but cells must be '.' or '*'.",
+		"":              "Invalid grid. Must have at least one cell.",
+		"**\n**\n":      "Invalid mine count 4. Must be between 1 and 3.",
+		"*\n.\n":        "Invalid dimensions 1x2. Must be at least 2x2.",
+		strings.Repeat(strings.Repeat(".", 41)+"\n", 2): "Invalid dimensions 41x2. Must be at most 40x40.",
+	}
+
+	for board, message := range invalid {
+		if _, err := ImportMineFile(strings.NewReader(board)); err == nil || err.Error() != message {
+			t.Errorf("Expected error %q importing %q (found %v)", message, board, err)
+		}
+	}
+
+	// Boards over MaxCells are turned down before anything is allocated for them.
+	original := MaxCells
+	MaxCells = 4
+	defer func() { MaxCells = original }()
+	if _, err := parseMineRows([]string{"*..", "..."}, Moore); err == nil || err.Error() != "Invalid dimensions 3x2. Must have at most 4 cells." {
+		t.Errorf("Expected an error for a board over MaxCells (found %v)", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	layout := []CellName{"D1", "B2", "A4", "B4", "E5"}
+	g, _ := NewGameFromLayout(layout, 5, 5)
+	same, _ := NewGameFromLayout(layout, 5, 5)
+	same.RevealCell("E3")
+	same.FlagCell("B2")
+
+	if g.Fingerprint() != same.Fingerprint() || len(g.Fingerprint()) != 64 {
+		t.Errorf("Expected games on the same board to share a fingerprint (found %s and %s)", g.Fingerprint(), same.Fingerprint())
+	}
+
+	different, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "D5"}, 5, 5)
+	wider, _ := NewGameFromLayout(layout, 6, 5)
+	if g.Fingerprint() == different.Fingerprint() || g.Fingerprint() == wider.Fingerprint() {
+		t.Error("Expected games on different boards to have different fingerprints")
+	}
+}
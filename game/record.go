@@ -0,0 +1,95 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"zephyri.co/mineswept/eventsource"
+)
+
+// EventRecord is the public form of an event, e.g. for sending to a client. Cell is the cell
+// the event happened to, if any, or Cells if it happened to several. Reveals also include how
+// many safe cells are left to reveal, and annotations the note made. Reveals and flags which the
+// player didn't make themselves say what did as Source: "AI" or "Cascade".
+// Like saved games, records count rows from 1 in cell names, whatever RowBase is.
+type EventRecord struct {
+	eventsource.BaseEvent
+	Type          string     `json:"type"`
+	Cell          CellName   `json:"cell,omitempty"`
+	Cells         []CellName `json:"cells,omitempty"`
+	RemainingSafe int        `json:"remainingSafe,omitempty"`
+	Note          string     `json:"note,omitempty"`
+	Source        string     `json:"source,omitempty"`
+}
+
+// UnmarshalJSON reads a record, checking that its type is one we know and that it has the
+// cells that type of event happens to.
+func (r *EventRecord) UnmarshalJSON(data []byte) error {
+	// A type without this method, so decoding it doesn't come back here.
+	type plainRecord EventRecord
+	var p plainRecord
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	cells := p.Cells
+	switch p.Type {
+	case "GameStarted", "GameWon", "GameLost":
+		cells = nil
+	case "CellRevealed", "CellFlagged", "CellUnflagged", "CellDefused", "CellAnnotated":
+		cells = []CellName{p.Cell}
+	case "CellsRevealed":
+		if len(cells) == 0 {
+			return fmt.Errorf("CellsRevealed event has no cells.")
+		}
+	default:
+		return fmt.Errorf("Unknown event type '%s'.", p.Type)
+	}
+
+	for _, cellName := range cells {
+		if _, err := parseSavedCellName(cellName); err != nil {
+			return fmt.Errorf("%s event has an invalid cell: %s", p.Type, err)
+		}
+	}
+
+	*r = EventRecord(p)
+	return nil
+}
+
+func recordOf(e event) EventRecord {
+	switch v := e.(type) {
+	case gameStartedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "GameStarted"}
+	case cellRevealedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellRevealed", Cell: savedCellName(v.CellCoord), RemainingSafe: v.RemainingSafe, Source: sourceOf(v.Source)}
+	case cellsRevealedEvent:
+		cells := make([]CellName, len(v.CellCoords))
+		for i, c := range v.CellCoords {
+			cells[i] = savedCellName(c)
+		}
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellsRevealed", Cell: savedInteraction(v.InteractionCellName), Cells: cells, RemainingSafe: v.RemainingSafe, Source: sourceOf(v.Source)}
+	case cellFlaggedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellFlagged", Cell: savedCellName(v.CellCoord), Source: sourceOf(v.Source)}
+	case cellUnflaggedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellUnflagged", Cell: savedCellName(v.CellCoord), Source: sourceOf(v.Source)}
+	case cellDefusedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellDefused", Cell: savedCellName(v.CellCoord)}
+	case cellAnnotatedEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "CellAnnotated", Cell: savedCellName(v.CellCoord), Note: v.Note}
+	case gameWonEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "GameWon"}
+	case gameLostEvent:
+		return EventRecord{BaseEvent: v.BaseEvent, Type: "GameLost"}
+	}
+
+	return EventRecord{}
+}
+
+// sourceOf names a source for a record, leaving out the usual one of the player.
+func sourceOf(s Source) string {
+	if s == SourceUser {
+		return ""
+	}
+
+	return s.String()
+}
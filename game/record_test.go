@@ -0,0 +1,50 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventRecordJSON(t *testing.T) {
+	useFakeClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), time.Second)
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+
+	for _, e := range g.events[1:] {
+		record := recordOf(e)
+		data, err := json.Marshal(record)
+		if err != nil {
+			t.Fatalf("Failed marshaling %s record: %s", record.Type, err)
+		}
+
+		var decoded EventRecord
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Failed unmarshaling %s: %s", data, err)
+		}
+
+		if !reflect.DeepEqual(record, decoded) {
+			t.Errorf("Record should survive a round trip through JSON\nExpected %+v\nFound    %+v", record, decoded)
+		}
+	}
+
+	expected := `{"aggregateId":"` + g.id + `","version":3,"at":"2020-01-01T12:00:02Z","type":"CellFlagged","cell":"B2"}`
+	if data, _ := json.Marshal(recordOf(g.events[2])); string(data) != expected {
+		t.Errorf("Expected flag record JSON %s\nFound %s", expected, data)
+	}
+
+	invalid := []string{
+		`{"type":"CellExploded","cell":"A1"}`,
+		`{"type":"CellRevealed"}`,
+		`{"type":"CellsRevealed","cell":"A1"}`,
+	}
+	for _, data := range invalid {
+		var decoded EventRecord
+		if err := json.Unmarshal([]byte(data), &decoded); err == nil {
+			t.Errorf("Expected an error unmarshaling %s", data)
+		}
+	}
+}
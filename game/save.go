@@ -0,0 +1,374 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"zephyri.co/mineswept/eventsource"
+)
+
+// SaveDir is where games are saved, listed and loaded from. It defaults to a hidden directory
+// in the user's home, but e.g. a server may want to keep them elsewhere.
+var SaveDir = defaultSaveDir()
+
+type GameInfo struct {
+	Id   string
+	Name string
+}
+
+// saveVersion is the version of the format games are saved in. It goes up with any change that
+// older code couldn't read, along with a migration from the version before.
+const saveVersion = 1
+
+// saveMigrations upgrade a save from the version it's keyed by to the next, so that saves from
+// before a change to the format can still be loaded.
+var saveMigrations = map[int]func(*savedGame){
+	1: migrateSave1To2,
+}
+
+// migrateSave1To2 is where saves will be upgraded to version 2, once there is one.
+func migrateSave1To2(saved *savedGame) {
+	saved.SchemaVersion = 2
+}
+
+// savedGame is the form a game takes on disk: the rules it's played by, and every event so far.
+type savedGame struct {
+	SchemaVersion int
+	Name          string `json:",omitempty"`
+	Options       Options
+	Events        []savedEvent
+}
+
+// migrate brings a save up to the current version, if it's a version we know of. Saves from
+// before versions were recorded are version 1.
+func (saved *savedGame) migrate() error {
+	if saved.SchemaVersion == 0 {
+		saved.SchemaVersion = 1
+	}
+
+	if saved.SchemaVersion < 1 || saved.SchemaVersion > saveVersion {
+		return fmt.Errorf("Unsupported save version %d. Must be between 1 and %d.", saved.SchemaVersion, saveVersion)
+	}
+
+	for saved.SchemaVersion < saveVersion {
+		saveMigrations[saved.SchemaVersion](saved)
+	}
+
+	return nil
+}
+
+// savedEvent can hold any kind of event. The starting grid is stored as rows of "." for safe
+// cells and "*" for mines, from which the adjacent mine counts can be worked out again. Cell
+// names count rows from 1, whatever RowBase is. Reveals record how many of their cells were
+// opened up by a cascade as Cascaded, and moves who made them as Source.
+type savedEvent struct {
+	eventsource.BaseEvent
+	Type          string
+	Cell          CellName   `json:",omitempty"`
+	Cells         []CellName `json:",omitempty"`
+	Interaction   CellName   `json:",omitempty"`
+	Mines         []string   `json:",omitempty"`
+	RemainingSafe int        `json:",omitempty"`
+	Note          string     `json:",omitempty"`
+	Cascaded      int        `json:",omitempty"`
+	Source        string     `json:",omitempty"`
+}
+
+func defaultSaveDir() string {
+	// Without a home directory, fall back to the working directory.
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".mineswept"
+	}
+
+	return filepath.Join(home, ".mineswept")
+}
+
+// ListSavedGames looks in SaveDir for any previously saved games. Games which can't be read are
+// left out.
+func ListSavedGames() []GameInfo {
+	games := []GameInfo{}
+	entries, err := os.ReadDir(SaveDir)
+	if err != nil {
+		return games
+	}
+
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || id == entry.Name() {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(SaveDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		var saved savedGame
+		if err := json.Unmarshal(data, &saved); err != nil {
+			continue
+		}
+
+		games = append(games, GameInfo{Id: id, Name: saved.Name})
+	}
+
+	return games
+}
+
+// Save writes the game's events to SaveDir, to be picked up later with LoadGame. The file is
+// replaced in one go, so a crash part way through can't corrupt it.
+func (g *game) Save() error {
+	dir := SaveDir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Cannot create saved games directory: %s", err)
+	}
+
+	saved := savedGame{SchemaVersion: saveVersion, Name: g.name, Options: g.options, Events: make([]savedEvent, len(g.events))}
+	for i, e := range g.events {
+		saved.Events[i] = saveEvent(e)
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+
+	// Write to a temporary file alongside the save, then move it into place.
+	tmp, err := os.CreateTemp(dir, g.id+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, g.id+".json")); err != nil {
+		return fmt.Errorf("Cannot save game %s: %s", g.id, err)
+	}
+
+	return nil
+}
+
+// LoadGame picks up a game written by Save, replaying its events to get back to where it was
+// left off. Undo history isn't saved, so earlier moves can't be undone. Every event is checked
+// before it's replayed, and versions must go up by one each time, so a save with events missing
+// or tampered with is an error rather than a different game.
+func LoadGame(id string) (*game, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, fmt.Errorf("Invalid game id '%s'.", id)
+	}
+
+	data, err := os.ReadFile(filepath.Join(SaveDir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load game %s: %s", id, err)
+	}
+
+	var saved savedGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("Cannot load game %s: %s", id, err)
+	}
+
+	if err := saved.migrate(); err != nil {
+		return nil, fmt.Errorf("Cannot load game %s: %s", id, err)
+	}
+
+	// A missing or repeated event could still replay to a game, just not the one saved.
+	for i := 1; i < len(saved.Events); i++ {
+		if expected := saved.Events[i-1].Version + 1; saved.Events[i].Version != expected {
+			return nil, fmt.Errorf("Cannot load game %s: Event %d should have version %d, but has %d. The save may be corrupt.", id, i+1, expected, saved.Events[i].Version)
+		}
+	}
+
+	events, err := loadEvents(saved.Events, saved.Options.Adjacency)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load game %s: %s", id, err)
+	}
+
+	g := &game{name: saved.Name, options: saved.Options, rng: newRandom(saved.Options.Seed)}
+	if err := g.replay(events); err != nil {
+		return nil, fmt.Errorf("Cannot load game %s: %s", id, err)
+	}
+
+	return g, nil
+}
+
+func saveEvent(e event) savedEvent {
+	switch v := e.(type) {
+	case gameStartedEvent:
+		return savedEvent{BaseEvent: v.BaseEvent, Type: "GameStarted", Mines: mineRows(v.grid)}
+	case cellRevealedEvent:
+		s := savedEvent{BaseEvent: v.BaseEvent, Type: "CellRevealed", Cell: savedCellName(v.CellCoord), Interaction: savedInteraction(v.InteractionCellName), RemainingSafe: v.RemainingSafe, Source: sourceOf(v.Source)}
+		if v.ByCascade {
+			s.Cascaded = 1
+		}
+		return s
+	case cellsRevealedEvent:
+		cells := make([]CellName, len(v.CellCoords))
+		for i, c := range v.CellCoords {
+			cells[i] = savedCellName(c)
+		}
+		return savedEvent{BaseEvent: v.BaseEvent, Type: "CellsRevealed", Cells: cells, Interaction: savedInteraction(v.InteractionCellName), RemainingSafe: v.RemainingSafe, Cascaded: v.Cascaded, Source: sourceOf(v.Source)}
+	case gameLostEvent:
+		return savedEvent{BaseEvent: v.BaseEvent, Type: "GameLost", Cell: savedCellName(v.DetonatedCoord)}
+	}
+
+	// The rest carry no more than their public record does.
+	r := recordOf(e)
+	return savedEvent{BaseEvent: r.BaseEvent, Type: r.Type, Cell: r.Cell, Note: r.Note, Source: r.Source}
+}
+
+// loadEvents turns saved events back into events, checking that every cell they refer to is
+// on the board they started with.
+func loadEvents(saved []savedEvent, adjacency Adjacency) ([]event, error) {
+	events := make([]event, len(saved))
+	var grid [][]cell
+
+	for i, s := range saved {
+		var err error
+		if events[i], grid, err = loadEvent(s, grid, adjacency); err != nil {
+			return nil, fmt.Errorf("Event %d is invalid: %s", i+1, err)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("There are no events.")
+	}
+
+	return events, nil
+}
+
+// loadEvent turns a saved event back into an event, given the grid the game started with.
+// That's nil until the game has started, and the grid to use for later events is returned.
+func loadEvent(s savedEvent, grid [][]cell, adjacency Adjacency) (event, [][]cell, error) {
+	cellAt := func(cellName CellName) (coordinate, error) {
+		coord, err := parseSavedCellName(cellName)
+		if err != nil {
+			return coord, err
+		}
+
+		if !containsCoordinate(coord, grid) {
+			return coord, fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+		}
+
+		return coord, nil
+	}
+
+	// Saves from before sources were recorded leave them out, and were all played by hand.
+	source := SourceUser
+	if s.Source != "" {
+		var err error
+		if source, err = parseSource(s.Source); err != nil {
+			return nil, grid, err
+		}
+	}
+
+	var e event
+	var err error
+	switch s.Type {
+	case "GameStarted":
+		if grid, err = parseMineRows(s.Mines, adjacency); err == nil {
+			e = gameStartedEvent{BaseEvent: s.BaseEvent, grid: grid}
+		}
+	case "CellRevealed":
+		revealed := cellRevealedEvent{BaseEvent: s.BaseEvent, InteractionCellName: loadedInteraction(s.Interaction), RemainingSafe: s.RemainingSafe, ByCascade: s.Cascaded > 0, Source: source}
+		revealed.CellCoord, err = cellAt(s.Cell)
+		e = revealed
+	case "CellsRevealed":
+		revealed := cellsRevealedEvent{BaseEvent: s.BaseEvent, InteractionCellName: loadedInteraction(s.Interaction), RemainingSafe: s.RemainingSafe, Cascaded: s.Cascaded, Source: source}
+		revealed.CellCoords = make([]coordinate, len(s.Cells))
+		for j := 0; j < len(s.Cells) && err == nil; j++ {
+			revealed.CellCoords[j], err = cellAt(s.Cells[j])
+		}
+		e = revealed
+	case "CellFlagged":
+		flagged := cellFlaggedEvent{BaseEvent: s.BaseEvent, Source: source}
+		flagged.CellCoord, err = cellAt(s.Cell)
+		e = flagged
+	case "CellUnflagged":
+		unflagged := cellUnflaggedEvent{BaseEvent: s.BaseEvent, Source: source}
+		unflagged.CellCoord, err = cellAt(s.Cell)
+		e = unflagged
+	case "CellDefused":
+		defused := cellDefusedEvent{BaseEvent: s.BaseEvent}
+		defused.CellCoord, err = cellAt(s.Cell)
+		e = defused
+	case "CellAnnotated":
+		annotated := cellAnnotatedEvent{BaseEvent: s.BaseEvent, Note: s.Note}
+		annotated.CellCoord, err = cellAt(s.Cell)
+		e = annotated
+	case "GameWon":
+		e = gameWonEvent{BaseEvent: s.BaseEvent}
+	case "GameLost":
+		lost := gameLostEvent{BaseEvent: s.BaseEvent}
+		lost.DetonatedCoord, err = cellAt(s.Cell)
+		e = lost
+	default:
+		err = fmt.Errorf("Unknown event type '%s'.", s.Type)
+	}
+
+	if err == nil && grid == nil {
+		err = fmt.Errorf("The game must start before anything else happens.")
+	}
+
+	return e, grid, err
+}
+
+// ReplayFromReader rebuilds a game from a stream of events, one JSON object per line in the
+// form they're saved in, e.g. a log too big to read in all at once. The log doesn't record the
+// rules the game was played by, so they're given as opts, which must match for the numbers on
+// the board to come out the same. Each event is checked and applied as it's read, and versions
+// must go up by one each time, so a gap in the log is caught. The log may start past version 1,
+// e.g. once it's been compacted under MaxEvents.
+func ReplayFromReader(r io.Reader, opts Options) (*game, error) {
+	g := &game{options: opts, rng: newRandom(opts.Seed)}
+	var grid [][]cell
+
+	decoder := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		var s savedEvent
+		if err := decoder.Decode(&s); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Event %d is invalid: %s", i, err)
+		}
+
+		e, nextGrid, err := loadEvent(s, grid, g.options.Adjacency)
+		if err != nil {
+			return nil, fmt.Errorf("Event %d is invalid: %s", i, err)
+		}
+		grid = nextGrid
+
+		if len(g.events) > 0 && s.Version != g.version+1 {
+			return nil, fmt.Errorf("Cannot replay event %d: Expected version %d, but found %d.", i, g.version+1, s.Version)
+		}
+
+		if err := g.checkEvent(e); err != nil {
+			return nil, fmt.Errorf("Cannot replay event %d: %s", i, err)
+		}
+
+		e.applyTo(g)
+		g.events = append(g.events, e)
+	}
+
+	if len(g.events) == 0 {
+		return nil, fmt.Errorf("There are no events.")
+	}
+
+	return g, nil
+}
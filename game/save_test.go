@@ -0,0 +1,374 @@
+package game
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useTempSaveDir points SaveDir somewhere disposable for the duration of a test, so that saved
+// games don't end up in the user's home.
+func useTempSaveDir(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "saves")
+	original := SaveDir
+	SaveDir = dir
+	t.Cleanup(func() {
+		SaveDir = original
+	})
+
+	return dir
+}
+
+func TestSaveAndLoadGame(t *testing.T) {
+	dir := useTempSaveDir(t)
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.FlagCell("E5")
+	g.FlagCell("A1")
+	g.FlagCell("A1")
+
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, g.id+".json")); err != nil {
+		t.Errorf("Expected a saved game file: %s", err)
+	}
+
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game: %s", err)
+	}
+
+	if !reflect.DeepEqual(g.Snapshot(), loaded.Snapshot()) {
+		t.Errorf("Loaded game should match the saved one\nExpected %+v\nFound    %+v", g.Snapshot(), loaded.Snapshot())
+	}
+
+	if len(loaded.events) != len(g.events) {
+		t.Errorf("Expected %d events in the loaded game (found %d)", len(g.events), len(loaded.events))
+	}
+
+	// Saving again replaces the file, and the loaded game carries on from where it was.
+	loaded.RevealCell("D1")
+	if err := loaded.Save(); err != nil {
+		t.Fatalf("Failed saving game again: %s", err)
+	}
+
+	lost, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game again: %s", err)
+	}
+
+	if !lost.isEnded || lost.grid[0][3] != loaded.grid[0][3] {
+		t.Error("Expected the game to be lost on D1 after loading")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the saved game file to be left behind (found %d files)", len(entries))
+	}
+}
+
+func TestListSavedGames(t *testing.T) {
+	dir := useTempSaveDir(t)
+
+	// Nothing has been saved yet, so the directory doesn't even exist.
+	if games := ListSavedGames(); len(games) != 0 {
+		t.Errorf("Expected no saved games (found %v)", games)
+	}
+
+	first, _ := NewGame(5, 5, 5)
+	first.name = "First Game"
+	second, _ := NewGame(8, 8, 10)
+	second.RevealCell("A1")
+	for _, g := range []*game{first, second} {
+		if err := g.Save(); err != nil {
+			t.Fatalf("Failed saving game: %s", err)
+		}
+	}
+
+	// Other files are ignored.
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600)
+
+	games := ListSavedGames()
+	if len(games) != 2 {
+		t.Fatalf("Expected 2 saved games (found %v)", games)
+	}
+
+	for _, info := range games {
+		g, err := LoadGame(info.Id)
+		if err != nil {
+			t.Errorf("Failed loading listed game %s: %s", info.Id, err)
+		} else if info.Name != g.name || (g.id != first.id && g.id != second.id) {
+			t.Errorf("Unexpected saved game %+v", info)
+		}
+	}
+
+	if games[0].Id == games[1].Id {
+		t.Errorf("Expected both games to be listed (found %v)", games)
+	}
+}
+
+func TestLoadGameErrors(t *testing.T) {
+	useTempSaveDir(t)
+
+	for _, id := range []string{"", "../secrets", "missing"} {
+		if _, err := LoadGame(id); err == nil {
+			t.Errorf("Expected an error loading game '%s'", id)
+		}
+	}
+}
+
+func TestSaveAndLoadWithZeroBasedRows(t *testing.T) {
+	dir := useTempSaveDir(t)
+	defer func() { RowBase = 1 }()
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	RowBase = 0
+	g.FlagCell("E4")
+	g.RevealCell("E2")
+	g.Save()
+
+	// The file names cells the same way whatever RowBase was when saving.
+	data, _ := os.ReadFile(filepath.Join(dir, g.id+".json"))
+	if !strings.Contains(string(data), `"Cell":"E5"`) || !strings.Contains(string(data), `"Cell":"E3"`) {
+		t.Errorf("Expected the saved cells to count rows from 1, found %s", data)
+	}
+
+	RowBase = 1
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game: %s", err)
+	}
+
+	if !gridsEqual(g.grid, loaded.grid) {
+		t.Errorf("Loaded game should match the saved one\nExpected %v\nFound    %v", g.grid, loaded.grid)
+	}
+}
+
+func TestSaveAndLoadCompactedGame(t *testing.T) {
+	dir := useTempSaveDir(t)
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.options.MaxEvents = 4
+	for _, cellName := range []CellName{"A1", "B1", "C1", "E1", "A2"} {
+		if err := g.RevealCell(cellName); err != nil {
+			t.Fatalf("Failed revealing %s: %s", cellName, err)
+		}
+	}
+
+	if len(g.events) > 4 {
+		t.Fatalf("Expected the log to be compacted to at most 4 events (found %d)", len(g.events))
+	}
+
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading compacted game: %s", err)
+	}
+
+	if !reflect.DeepEqual(g.Snapshot(), loaded.Snapshot()) {
+		t.Errorf("Loaded game should match the saved one\nExpected %+v\nFound    %+v", g.Snapshot(), loaded.Snapshot())
+	}
+
+	// The saved events replay one at a time too.
+	var saved savedGame
+	data, err := os.ReadFile(filepath.Join(dir, g.id+".json"))
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		t.Fatalf("Failed reading saved game: %s", err)
+	}
+
+	var lines strings.Builder
+	for _, s := range saved.Events {
+		data, _ := json.Marshal(s)
+		lines.Write(append(data, '\n'))
+	}
+
+	replayed, err := ReplayFromReader(strings.NewReader(lines.String()), g.options)
+	if err != nil || !reflect.DeepEqual(g.Snapshot(), replayed.Snapshot()) {
+		t.Errorf("Expected the compacted log to replay from a reader (error %v)", err)
+	}
+}
+
+func TestLoadGameRejectsMissingEvents(t *testing.T) {
+	dir := useTempSaveDir(t)
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	for _, cellName := range []CellName{"A1", "C1"} {
+		if err := g.FlagCell(cellName); err != nil {
+			t.Fatalf("Failed flagging %s: %s", cellName, err)
+		}
+	}
+	if err := g.RevealCell("E1"); err != nil {
+		t.Fatalf("Failed revealing E1: %s", err)
+	}
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	// Drop the middle event, which still leaves a game that replays.
+	editSave(t, filepath.Join(dir, g.id+".json"), func(saved *savedGame) {
+		saved.Events = append(saved.Events[:2], saved.Events[3:]...)
+	})
+
+	expected := "Cannot load game " + g.id + ": Event 3 should have version 3, but has 4. The save may be corrupt."
+	if _, err := LoadGame(g.id); err == nil || err.Error() != expected {
+		t.Errorf("Expected an error for the missing event (found %v)", err)
+	}
+}
+
+func TestLoadGameRejectsUnknownVersion(t *testing.T) {
+	dir := useTempSaveDir(t)
+	g, _ := NewGame(5, 5, 5)
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	editSave(t, filepath.Join(dir, g.id+".json"), func(saved *savedGame) {
+		if saved.SchemaVersion != saveVersion {
+			t.Errorf("Expected the game to be saved as version %d (found %d)", saveVersion, saved.SchemaVersion)
+		}
+
+		saved.SchemaVersion = 99
+	})
+
+	expected := "Cannot load game " + g.id + ": Unsupported save version 99. Must be between 1 and 1."
+	if _, err := LoadGame(g.id); err == nil || err.Error() != expected {
+		t.Errorf("Expected an error for the unknown version (found %v)", err)
+	}
+}
+
+// editSave changes a saved game on disk, e.g. to corrupt it.
+func editSave(t *testing.T, path string, edit func(*savedGame)) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading saved game: %s", err)
+	}
+
+	var saved savedGame
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed decoding saved game: %s", err)
+	}
+
+	edit(&saved)
+	if data, err = json.Marshal(saved); err != nil {
+		t.Fatalf("Failed encoding saved game: %s", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed writing saved game: %s", err)
+	}
+}
+
+func TestLoadEventsRejectsCellsOffTheBoard(t *testing.T) {
+	saved := []savedEvent{
+		{Type: "GameStarted", Mines: []string{"*.", ".."}},
+		{Type: "CellFlagged", Cell: "C3"},
+	}
+
+	if _, err := loadEvents(saved, Moore); err == nil || err.Error() != "Event 2 is invalid: Invalid cell C3 (2,2)." {
+		t.Errorf("Expected an error for the flag off the board (found %v)", err)
+	}
+}
+
+func TestSaveAndLoadAnnotations(t *testing.T) {
+	useTempSaveDir(t)
+
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.AnnotateCell("B1", "50/50")
+	g.AnnotateCell("C3", "mine?")
+	g.AnnotateCell("C3", "")
+
+	if s := g.Snapshot(); s.Cells[0][1].Note != "50/50" || s.Cells[2][2].Note != "" {
+		t.Errorf("Expected only B1 to have a note (found %q and %q)", s.Cells[0][1].Note, s.Cells[2][2].Note)
+	}
+
+	if g.revealedSafeCount != 1 || g.isEnded {
+		t.Errorf("Expected notes to have no effect on play")
+	}
+
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game: %s", err)
+	}
+
+	if note := loaded.Snapshot().Cells[0][1].Note; note != "50/50" {
+		t.Errorf("Expected B1's note to survive loading (found %q)", note)
+	}
+
+	if err := g.AnnotateCell("F1", "off the board"); err == nil {
+		t.Error("Expected an error annotating F1, which is off the board")
+	}
+}
+
+func TestSaveAndLoadSeed(t *testing.T) {
+	useTempSaveDir(t)
+
+	g, _ := NewGame(10, 10, 15)
+	if err := g.Save(); err != nil {
+		t.Fatalf("Failed saving game: %s", err)
+	}
+
+	loaded, err := LoadGame(g.id)
+	if err != nil {
+		t.Fatalf("Failed loading game: %s", err)
+	}
+
+	if loaded.Seed() != g.Seed() {
+		t.Errorf("Expected the loaded game to have seed %d (found %d)", g.Seed(), loaded.Seed())
+	}
+}
+
+func TestReplayFromReader(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.FlagCell("B2")
+	g.RevealCell("A1")
+
+	lines := make([]string, len(g.events))
+	for i, e := range g.events {
+		data, _ := json.Marshal(saveEvent(e))
+		lines[i] = string(data)
+	}
+
+	replayed, err := ReplayFromReader(strings.NewReader(strings.Join(lines, "\n")+"\n"), Options{})
+	if err != nil {
+		t.Fatalf("Failed replaying events from a reader: %s", err)
+	}
+
+	if !reflect.DeepEqual(g.Snapshot(), replayed.Snapshot()) || len(replayed.events) != len(g.events) {
+		t.Errorf("Replayed game should match the original\nExpected %+v\nFound    %+v", g.Snapshot(), replayed.Snapshot())
+	}
+
+	// Leaving out an event leaves a gap in the versions.
+	gap := append(append([]string{}, lines[:2]...), lines[3:]...)
+	_, err = ReplayFromReader(strings.NewReader(strings.Join(gap, "\n")), Options{})
+	if err == nil || err.Error() != "Cannot replay event 3: Expected version 3, but found 4." {
+		t.Errorf("Expected an error for a gap in the versions (found %v)", err)
+	}
+
+	if _, err := ReplayFromReader(strings.NewReader(lines[0]+"\n{"), Options{}); err == nil {
+		t.Error("Expected an error for a truncated event")
+	}
+
+	// The numbers on the board depend on the rules it's replayed by.
+	fourWay, _ := NewGameWithOptions(5, 5, 5, Options{Adjacency: VonNeumann, Seed: 7})
+	data, _ := json.Marshal(saveEvent(fourWay.events[0]))
+	replayed, err = ReplayFromReader(strings.NewReader(string(data)+"\n"), fourWay.options)
+	if err != nil || !gridsEqual(fourWay.grid, replayed.grid) {
+		t.Errorf("Expected a VonNeumann game to replay to the same board (error %v)", err)
+	}
+}
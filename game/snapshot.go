@@ -0,0 +1,187 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snapshot is the player's view of a game at a point in time. Mines are only included once
+// the cell is revealed, so it's safe to hand to a client.
+type Snapshot struct {
+	Id             string       `json:"id"`
+	Version        int          `json:"version"`
+	Width          int          `json:"width"`
+	Height         int          `json:"height"`
+	MinesRemaining int          `json:"minesRemaining"`
+	IsEnded        bool         `json:"isEnded"`
+	IsWon          bool         `json:"isWon"`
+	Cells          [][]CellView `json:"cells"`
+}
+
+// CellView is a single cell of a Snapshot.
+type CellView struct {
+	IsRevealed    bool `json:"isRevealed"`
+	IsFlagged     bool `json:"isFlagged"`
+	IsMined       bool `json:"isMined"`
+	AdjacentMines int  `json:"adjacentMines"`
+
+	// Note is the player's annotation on the cell, if any.
+	Note string `json:"note,omitempty"`
+
+	// Marker names what the cell shows besides a count, if anything, so that clients can pick
+	// an icon or pattern for it without relying on color: one of the Marker constants.
+	Marker string `json:"marker,omitempty"`
+}
+
+// Markers a CellView can carry.
+const (
+	MarkerFlag = "flag"
+	MarkerMine = "mine"
+)
+
+// Snapshot captures the current state of the game as the player sees it.
+func (g *game) Snapshot() Snapshot {
+	s := Snapshot{
+		Id:             g.id,
+		Version:        g.version,
+		Height:         len(g.grid),
+		MinesRemaining: g.MinesRemaining(),
+		IsEnded:        g.isEnded,
+		IsWon:          g.isWon,
+		Cells:          make([][]CellView, len(g.grid)),
+	}
+
+	if len(g.grid) > 0 {
+		s.Width = len(g.grid[0])
+	}
+
+	for y := range s.Cells {
+		s.Cells[y] = make([]CellView, len(g.grid[y]))
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		view := CellView{IsRevealed: target.isRevealed, IsFlagged: target.isFlagged, Note: g.notes[c]}
+		if target.isRevealed {
+			view.IsMined = target.isMined
+			view.AdjacentMines = target.adjacentMines
+		}
+
+		if view.IsMined {
+			view.Marker = MarkerMine
+		} else if target.isFlagged {
+			view.Marker = MarkerFlag
+		}
+		s.Cells[c[1]][c[0]] = view
+	})
+
+	return s
+}
+
+// SnapshotsEqual checks whether two snapshots show the same board: the same size, with every
+// cell alike. Which game each came from, and its version, don't matter.
+func SnapshotsEqual(a, b Snapshot) bool {
+	if a.Width != b.Width || a.Height != b.Height || len(a.Cells) != len(b.Cells) {
+		return false
+	}
+
+	for y := range a.Cells {
+		if len(a.Cells[y]) != len(b.Cells[y]) {
+			return false
+		}
+
+		for x := range a.Cells[y] {
+			if a.Cells[y][x] != b.Cells[y][x] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Codes used by RenderMatrix for cells without a count to show.
+const (
+	RenderUnrevealed = -1
+	RenderFlagged    = -2
+	RenderMine       = -3
+)
+
+// RenderMatrix encodes the player's view of the game as plain numbers, which are simple to
+// draw in any language: a revealed cell's count of adjacent mines, or one of the Render codes.
+func (g *game) RenderMatrix() [][]int {
+	matrix := make([][]int, len(g.grid))
+	for y := range matrix {
+		matrix[y] = make([]int, len(g.grid[y]))
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		code := RenderUnrevealed
+		if target.isRevealed && target.isMined {
+			code = RenderMine
+		} else if target.isRevealed {
+			code = target.adjacentMines
+		} else if target.isFlagged {
+			code = RenderFlagged
+		}
+		matrix[c[1]][c[0]] = code
+	})
+
+	return matrix
+}
+
+// RenderRegion draws the player's view of a rectangle of the board as text, with column and
+// row headers for the cells it covers, e.g. to show part of a board too big for the screen.
+// Unrevealed cells are ".", flags "F", revealed mines "*", and revealed cells their count of
+// adjacent mines, or "-" for none.
+func (g *game) RenderRegion(topLeft, bottomRight CellName) (string, error) {
+	corners := [2]coordinate{}
+	for i, cellName := range []CellName{topLeft, bottomRight} {
+		coord, err := cellNameToCoordinate(cellName)
+		if err != nil {
+			return "", err
+		}
+
+		if !containsCoordinate(coord, g.grid) {
+			return "", fmt.Errorf("Invalid cell %s (%d,%d).", cellName, coord[0], coord[1])
+		}
+		corners[i] = coord
+	}
+
+	from, to := corners[0], corners[1]
+	if from[0] > to[0] || from[1] > to[1] {
+		return "", fmt.Errorf("Invalid region %s to %s. The top-left cell must come first.", topLeft, bottomRight)
+	}
+
+	// Line everything up under the longest column key, beside the longest row number.
+	headers := ColumnHeaders(to[0] + 1)[from[0]:]
+	cellWidth := len(headers[len(headers)-1])
+	labelWidth := len(fmt.Sprint(to[1] + RowBase))
+
+	var out strings.Builder
+	out.WriteString(strings.Repeat(" ", labelWidth))
+	for _, header := range headers {
+		fmt.Fprintf(&out, " %*s", cellWidth, header)
+	}
+	out.WriteString("\n")
+
+	for y := from[1]; y <= to[1]; y++ {
+		fmt.Fprintf(&out, "%*d", labelWidth, y+RowBase)
+		for x := from[0]; x <= to[0]; x++ {
+			target := g.grid[y][x]
+			symbol := "."
+			if target.isRevealed && target.isMined {
+				symbol = "*"
+			} else if target.isRevealed && target.adjacentMines == 0 {
+				symbol = "-"
+			} else if target.isRevealed {
+				symbol = fmt.Sprint(target.adjacentMines)
+			} else if target.isFlagged {
+				symbol = "F"
+			}
+			fmt.Fprintf(&out, " %*s", cellWidth, symbol)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
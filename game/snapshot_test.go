@@ -0,0 +1,147 @@
+package game
+
+import (
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+	s := g.Snapshot()
+
+	if s.Id != g.id || s.Width != 5 || s.Height != 5 {
+		t.Errorf("Snapshot has wrong id or dimensions: %s %dx%d", s.Id, s.Width, s.Height)
+	}
+
+	if s.MinesRemaining != 4 {
+		t.Errorf("Expected 4 mines remaining after one flag (found %d)", s.MinesRemaining)
+	}
+
+	if a1 := s.Cells[0][0]; !a1.IsRevealed || a1.AdjacentMines != 1 {
+		t.Errorf("Expected A1 to be revealed with 1 adjacent mine (found %+v)", a1)
+	}
+
+	if b2 := s.Cells[1][1]; !b2.IsFlagged || b2.IsRevealed || b2.IsMined {
+		t.Errorf("Expected B2 to be flagged without revealing its mine (found %+v)", b2)
+	}
+
+	if d1 := s.Cells[0][3]; d1.IsMined || d1.AdjacentMines != 0 {
+		t.Errorf("Snapshot leaked the contents of unrevealed cell D1 (found %+v)", d1)
+	}
+}
+
+func TestSnapshotMarkers(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.FlagCell("B2")
+	if marker := g.Snapshot().Cells[1][1].Marker; marker != MarkerFlag {
+		t.Errorf("Expected flagged B2 to be marked %s (found '%s')", MarkerFlag, marker)
+	}
+
+	g.RevealCell("D1")
+	s := g.Snapshot()
+	if marker := s.Cells[0][3].Marker; marker != MarkerMine {
+		t.Errorf("Expected D1 to be marked %s once the game was lost (found '%s')", MarkerMine, marker)
+	}
+
+	if marker := s.Cells[0][0].Marker; marker != "" {
+		t.Errorf("Expected no marker on A1 (found '%s')", marker)
+	}
+}
+
+func TestRenderMatrix(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	g.RevealCell("A1")
+	g.RevealCell("E3")
+	g.FlagCell("B2")
+
+	expected := map[CellName]int{
+		"A1": 1,
+		"E3": 0,
+		"C2": 2,
+		"D4": 1,
+		"B2": RenderFlagged,
+		"A5": RenderUnrevealed,
+	}
+
+	m := g.RenderMatrix()
+	for cellName, code := range expected {
+		c, _ := cellNameToCoordinate(cellName)
+		if m[c[1]][c[0]] != code {
+			t.Errorf("Expected %s to be drawn as %d (found %d)", cellName, code, m[c[1]][c[0]])
+		}
+	}
+
+	// Losing shows the mines.
+	g.RevealCell("D1")
+	if m = g.RenderMatrix(); m[0][3] != RenderMine {
+		t.Errorf("Expected D1 to be drawn as a mine after losing (found %d)", m[0][3])
+	}
+}
+
+func TestSnapshotsEqual(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("A1")
+	g.FlagCell("B2")
+	g.RevealCell("E3")
+
+	a, b := &game{}, &game{}
+	a.replay(g.events)
+	b.replay(g.events)
+
+	if !gridsEqual(a.grid, b.grid) || !SnapshotsEqual(a.Snapshot(), b.Snapshot()) {
+		t.Errorf("Expected games replayed from the same events to be equal")
+	}
+
+	b.grid[0][1].isRevealed = true
+	if gridsEqual(a.grid, b.grid) || SnapshotsEqual(a.Snapshot(), b.Snapshot()) {
+		t.Errorf("Expected games differing in one cell to be unequal")
+	}
+
+	if gridsEqual(a.grid, a.grid[:4]) || SnapshotsEqual(a.Snapshot(), Snapshot{}) {
+		t.Errorf("Expected boards of different sizes to be unequal")
+	}
+}
+
+func TestRenderRegion(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 12, 12)
+	g.RevealCell("E3")
+	g.FlagCell("D1")
+
+	// Headers cover only the cells in the region.
+	expected := "" +
+		"  C D E\n" +
+		"1 . F 1\n" +
+		"2 2 1 1\n" +
+		"3 2 - -\n"
+	if found, err := g.RenderRegion("C1", "E3"); err != nil || found != expected {
+		t.Errorf("Expected region C1 to E3 to render as\n%s\nFound (error %v)\n%s", expected, err, found)
+	}
+
+	// Row numbers are lined up when they have two digits.
+	expected = "" +
+		"   I J K\n" +
+		" 9 - - -\n" +
+		"10 - - -\n"
+	if found, err := g.RenderRegion("I9", "K10"); err != nil || found != expected {
+		t.Errorf("Expected region I9 to K10 to render as\n%s\nFound (error %v)\n%s", expected, err, found)
+	}
+
+	if _, err := g.RenderRegion("E3", "C1"); err == nil {
+		t.Error("Expected an error for a region given bottom-right first")
+	}
+
+	if _, err := g.RenderRegion("A1", "M1"); err == nil {
+		t.Error("Expected an error for a region off the board")
+	}
+}
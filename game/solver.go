@@ -0,0 +1,562 @@
+package game
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// deduce works out which unrevealed cells are certainly safe or certainly mined, using only
+// what the player can see: the numbers on revealed cells and the total mine count. Flags are
+// ignored since the player may have misplaced them. Both lists are in row-major order.
+func (g *game) deduce() (safe, mined []coordinate) {
+	known := make(map[coordinate]bool)
+
+	// Differences between overlapping constraints are constraints too, and are kept so they
+	// can be combined further on later passes.
+	derived := []constraint{}
+	seen := make(map[string]bool)
+
+	// Keep applying the rules until they stop turning up anything new, since each finding
+	// can unlock others.
+	for changed := true; changed; {
+		changed = false
+		mark := func(coords []coordinate, isMined bool) {
+			for _, c := range coords {
+				if _, ok := known[c]; !ok {
+					known[c] = isMined
+					changed = true
+				}
+			}
+		}
+
+		constraints := g.constraintsGiven(known)
+		for _, c := range derived {
+			if c = c.given(known); len(c.cells) > 0 {
+				constraints = append(constraints, c)
+			}
+		}
+
+		// The mine total is public too. Any mines not accounted for by a set of non-overlapping
+		// constraints must be somewhere among the rest of the unknown cells.
+		constraints = append(constraints, g.remainderGiven(known, constraints))
+
+		for _, a := range constraints {
+			// All remaining mines are accounted for, or every unknown cell must be a mine.
+			if a.mines == 0 {
+				mark(a.cells, false)
+			} else if a.mines == len(a.cells) {
+				mark(a.cells, true)
+			}
+
+			// Only the local constraints are combined, as the remainder can be huge.
+			if len(a.cells) > 8 {
+				continue
+			}
+
+			// If one constraint's cells are a subset of another's, the difference between
+			// them holds the difference in mines.
+			for _, b := range constraints {
+				if len(a.cells) >= len(b.cells) || len(b.cells) > 8 || !isSubset(a.cells, b.cells) {
+					continue
+				}
+
+				diff := constraint{cells: difference(b.cells, a.cells), mines: b.mines - a.mines}
+				if key := fmt.Sprint(diff); !seen[key] {
+					seen[key] = true
+					derived = append(derived, diff)
+					changed = true
+				}
+			}
+		}
+	}
+
+	g.forEachCell(func(c coordinate, _ *cell) {
+		if isMined, ok := known[c]; !ok {
+			return
+		} else if isMined {
+			mined = append(mined, c)
+		} else {
+			safe = append(safe, c)
+		}
+	})
+
+	return safe, mined
+}
+
+// Frontier lists the unrevealed, unflagged cells next to at least one revealed number, in
+// row-major order. They're the cells the numbers say anything about, so are where solving
+// happens.
+func (g *game) Frontier() []CellName {
+	frontier := []CellName{}
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isRevealed || target.isFlagged {
+			return
+		}
+
+		for _, n := range g.neighbors(c) {
+			if neighbor := g.grid[n[1]][n[0]]; neighbor.isRevealed && neighbor.adjacentMines > 0 {
+				frontier = append(frontier, coordinateToCellName(c))
+				return
+			}
+		}
+	})
+
+	return frontier
+}
+
+// Constraint says that exactly Mines of the given Cells are mined. Together, a board's
+// constraints are the usual starting point for a solver.
+type Constraint struct {
+	Cells []CellName `json:"cells"`
+	Mines int        `json:"mines"`
+}
+
+// Constraints gives what each revealed number says about its unrevealed neighbors, taking
+// flags at their word: the unflagged neighbors, and how many mines are among them once the
+// flagged ones are accounted for. Numbers with no unflagged neighbors left are skipped. Both the
+// constraints and their cells are in row-major order.
+func (g *game) Constraints() []Constraint {
+	flagged := make(map[coordinate]bool)
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isFlagged && !target.isRevealed {
+			flagged[c] = true
+		}
+	})
+
+	constraints := []Constraint{}
+	for _, c := range g.constraintsGiven(flagged) {
+		sort.Slice(c.cells, func(i, j int) bool {
+			a, b := c.cells[i], c.cells[j]
+			return a[1] < b[1] || (a[1] == b[1] && a[0] < b[0])
+		})
+
+		cellNames := make([]CellName, len(c.cells))
+		for i, coord := range c.cells {
+			cellNames[i] = coordinateToCellName(coord)
+		}
+		constraints = append(constraints, Constraint{Cells: cellNames, Mines: c.mines})
+	}
+
+	return constraints
+}
+
+// MinMinesRemaining gives the fewest unflagged mines the revealed numbers allow for, taking
+// flags at their word. Adding up every number overcounts mines shared between them, so only
+// numbers with no unflagged neighbors in common are added, the biggest first. It's a lower
+// bound, and may be below the true minimum where the numbers overlap a lot.
+func (g *game) MinMinesRemaining() int {
+	constraints := g.Constraints()
+	sort.SliceStable(constraints, func(i, j int) bool {
+		return constraints[i].Mines > constraints[j].Mines
+	})
+
+	min := 0
+	covered := make(map[CellName]bool)
+	for _, c := range constraints {
+		overlapping := false
+		for _, cellName := range c.Cells {
+			overlapping = overlapping || covered[cellName]
+		}
+		if overlapping || c.Mines <= 0 {
+			continue
+		}
+
+		for _, cellName := range c.Cells {
+			covered[cellName] = true
+		}
+		min += c.Mines
+	}
+
+	return min
+}
+
+// constraint says that exactly mines of the given cells are mined.
+type constraint struct {
+	cells []coordinate
+	mines int
+}
+
+// given removes any cells whose status is already known from the constraint.
+func (c constraint) given(known map[coordinate]bool) constraint {
+	reduced := constraint{mines: c.mines}
+	for _, cell := range c.cells {
+		if isMined, ok := known[cell]; !ok {
+			reduced.cells = append(reduced.cells, cell)
+		} else if isMined {
+			reduced.mines--
+		}
+	}
+
+	return reduced
+}
+
+// constraintsGiven builds a constraint from each revealed number, covering its unrevealed
+// neighbors whose status isn't already known.
+func (g *game) constraintsGiven(known map[coordinate]bool) []constraint {
+	constraints := []constraint{}
+	if g.isEnded {
+		return constraints
+	}
+
+	g.forEachCell(func(coord coordinate, target *cell) {
+		if !target.isRevealed {
+			return
+		}
+
+		c := constraint{mines: target.adjacentMines}
+		for _, n := range g.neighbors(coord) {
+			if g.grid[n[1]][n[0]].isRevealed {
+				continue
+			}
+
+			if isMined, ok := known[n]; !ok {
+				c.cells = append(c.cells, n)
+			} else if isMined {
+				c.mines--
+			}
+		}
+
+		if len(c.cells) > 0 {
+			constraints = append(constraints, c)
+		}
+	})
+
+	return constraints
+}
+
+// remainderGiven builds a constraint covering every unknown cell outside of a set of
+// non-overlapping constraints, holding whatever mines those constraints don't account for.
+func (g *game) remainderGiven(known map[coordinate]bool, constraints []constraint) constraint {
+	remainder := constraint{mines: g.mineCount}
+	covered := make(map[coordinate]bool)
+	for _, c := range constraints {
+		if overlaps(c.cells, covered) {
+			continue
+		}
+
+		for _, cell := range c.cells {
+			covered[cell] = true
+		}
+		remainder.mines -= c.mines
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isRevealed || covered[c] {
+			return
+		}
+
+		if isMined, ok := known[c]; !ok {
+			remainder.cells = append(remainder.cells, c)
+		} else if isMined {
+			remainder.mines--
+		}
+	})
+
+	return remainder
+}
+
+func overlaps(coords []coordinate, set map[coordinate]bool) bool {
+	for _, c := range coords {
+		if set[c] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSubset(a, b []coordinate) bool {
+	for _, c := range a {
+		if !containsCoord(b, c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func difference(a, b []coordinate) []coordinate {
+	diff := []coordinate{}
+	for _, c := range a {
+		if !containsCoord(b, c) {
+			diff = append(diff, c)
+		}
+	}
+
+	return diff
+}
+
+func containsCoord(coords []coordinate, c coordinate) bool {
+	for _, other := range coords {
+		if other == c {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AutoPlayStep makes a single move which the revealed numbers prove to be correct: revealing
+// a safe cell if there is one, otherwise flagging a mine. It reports whether a move was made,
+// which won't be the case once the game is over or when only a guess would help.
+func (g *game) AutoPlayStep() (bool, error) {
+	if g.isEnded {
+		return false, nil
+	}
+
+	g.source = SourceAI
+	defer func() { g.source = SourceUser }()
+
+	safe, mined := g.deduce()
+	for _, c := range safe {
+		if !g.grid[c[1]][c[0]].isFlagged {
+			return true, g.RevealCell(coordinateToCellName(c))
+		}
+	}
+
+	for _, c := range mined {
+		if !g.grid[c[1]][c[0]].isFlagged {
+			return true, g.FlagCell(coordinateToCellName(c))
+		}
+	}
+
+	return false, nil
+}
+
+// IsStalemate reports whether the player has to guess to get any further: the game is still
+// being played, but the revealed numbers prove no cell safe, and prove no unflagged cell mined.
+func (g *game) IsStalemate() bool {
+	if g.isEnded || g.RemainingSafeCells() == 0 {
+		return false
+	}
+
+	safe, mined := g.deduce()
+	if len(safe) > 0 {
+		return false
+	}
+
+	for _, c := range mined {
+		if !g.grid[c[1]][c[0]].isFlagged {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsProvablySafe reports whether the revealed numbers prove an unrevealed cell safe, e.g. so
+// a client can warn before a risky click. Anything else, including an invalid cell, is false.
+func (g *game) IsProvablySafe(cellName CellName) bool {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil || g.isEnded {
+		return false
+	}
+
+	safe, _ := g.deduce()
+	return containsCoord(safe, coord)
+}
+
+// IsProvablyMine is like IsProvablySafe, but reports whether the cell is proven mined.
+func (g *game) IsProvablyMine(cellName CellName) bool {
+	coord, err := cellNameToCoordinate(cellName)
+	if err != nil || g.isEnded {
+		return false
+	}
+
+	_, mined := g.deduce()
+	return containsCoord(mined, coord)
+}
+
+// MineProbabilities estimates how likely each unrevealed, unflagged cell is to be mined, from
+// what the player can see. Cells the numbers prove safe or mined are 0 or 1. Otherwise, each
+// number spreads its mines evenly over its unknown neighbors, and a cell next to several takes
+// the highest of their estimates. Cells away from the numbers share whatever mines are left.
+// It's a rough guide for when a guess is needed, rather than an exact probability.
+func (g *game) MineProbabilities() map[CellName]float64 {
+	probabilities := make(map[CellName]float64)
+	if g.isEnded {
+		return probabilities
+	}
+
+	safe, mined := g.deduce()
+	known := make(map[coordinate]bool)
+	for _, c := range safe {
+		known[c] = false
+	}
+	for _, c := range mined {
+		known[c] = true
+	}
+
+	local := make(map[coordinate]float64)
+	constraints := g.constraintsGiven(known)
+	for _, c := range constraints {
+		p := float64(c.mines) / float64(len(c.cells))
+		for _, cell := range c.cells {
+			if q, ok := local[cell]; !ok || p > q {
+				local[cell] = p
+			}
+		}
+	}
+
+	density := 0.0
+	if remainder := g.remainderGiven(known, constraints); len(remainder.cells) > 0 {
+		density = math.Min(1, math.Max(0, float64(remainder.mines)/float64(len(remainder.cells))))
+	}
+
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isRevealed || target.isFlagged {
+			return
+		}
+
+		p, ok := local[c]
+		if isMined, isKnown := known[c]; isKnown && isMined {
+			p = 1
+		} else if isKnown {
+			p = 0
+		} else if !ok {
+			p = density
+		}
+		probabilities[coordinateToCellName(c)] = p
+	})
+
+	return probabilities
+}
+
+// RevealSafest reveals the cell least likely to be mined, going by MineProbabilities, for when
+// only a guess will do. Of equally likely cells, it picks the one next to the most revealed
+// cells, since it's likely to tell the player the most. It returns the cell revealed.
+func (g *game) RevealSafest() (CellName, error) {
+	if len(g.grid) == 0 {
+		return "", ErrGameNotStarted
+	} else if g.isEnded {
+		return "", ErrGameEnded
+	}
+
+	probabilities := g.MineProbabilities()
+	var safest CellName
+	lowest, mostRevealed := 2.0, -1
+	g.forEachCell(func(c coordinate, _ *cell) {
+		p, ok := probabilities[coordinateToCellName(c)]
+		if !ok {
+			return
+		}
+
+		revealed := 0
+		for _, n := range g.neighbors(c) {
+			if g.grid[n[1]][n[0]].isRevealed {
+				revealed++
+			}
+		}
+
+		if p < lowest || (p == lowest && revealed > mostRevealed) {
+			safest, lowest, mostRevealed = coordinateToCellName(c), p, revealed
+		}
+	})
+
+	if safest == "" {
+		return "", fmt.Errorf("No cells left to reveal.")
+	}
+
+	g.source = SourceAI
+	defer func() { g.source = SourceUser }()
+
+	return safest, g.RevealCell(safest)
+}
+
+// FlagAllKnownMines flags every unflagged cell which the revealed numbers prove to be mined,
+// e.g. to tidy up the end of a game. It returns the cells it flagged.
+func (g *game) FlagAllKnownMines() []CellName {
+	flagged := []CellName{}
+	if g.isEnded {
+		return flagged
+	}
+
+	g.source = SourceAI
+	defer func() { g.source = SourceUser }()
+
+	_, mined := g.deduce()
+	for _, c := range mined {
+		if g.grid[c[1]][c[0]].isFlagged {
+			continue
+		}
+
+		cellName := coordinateToCellName(c)
+		if err := g.FlagCell(cellName); err == nil {
+			flagged = append(flagged, cellName)
+		}
+	}
+
+	return flagged
+}
+
+// RequiresGuessing reports whether the board needs luck to finish. Starting from what's been
+// revealed so far plus every opening, it plays out the rest using only what the revealed
+// numbers prove, and checks whether that clears the board. The game itself isn't changed.
+func (g *game) RequiresGuessing() bool {
+	_, solved := g.solve()
+	return !solved
+}
+
+// solve plays out the board on a copy of the game, first clicking every opening and then only
+// cells which deduce proves safe. It returns the cells clicked, in order, and whether that was
+// enough to reveal every safe cell.
+func (g *game) solve() ([]CellName, bool) {
+	sim := &game{
+		options:                    g.options,
+		grid:                       make([][]cell, len(g.grid)),
+		cellCount:                  g.cellCount,
+		mineCount:                  g.mineCount,
+		revealedOrFlaggedCellCount: g.revealedOrFlaggedCellCount,
+		revealedSafeCount:          g.revealedSafeCount,
+		regionIds:                  g.regionIds,
+		regions:                    g.regions,
+	}
+	for y := range g.grid {
+		sim.grid[y] = append([]cell(nil), g.grid[y]...)
+	}
+
+	clicks := []CellName{}
+	click := func(c coordinate) {
+		if sim.grid[c[1]][c[0]].isRevealed {
+			return
+		}
+
+		clicks = append(clicks, coordinateToCellName(c))
+		sim.markRevealed(c)
+		for _, n := range sim.cascadeFrom(c) {
+			sim.markRevealed(n)
+		}
+	}
+
+	sim.forEachCell(func(c coordinate, target *cell) {
+		if !target.isMined && target.adjacentMines == 0 {
+			click(c)
+		}
+	})
+
+	for sim.RemainingSafeCells() > 0 {
+		safe, _ := sim.deduce()
+		if len(safe) == 0 {
+			return clicks, false
+		}
+
+		for _, c := range safe {
+			click(c)
+		}
+	}
+
+	return clicks, true
+}
+
+// SolutionPath lists cells to reveal, in order, which clear the board without any guessing,
+// e.g. for a tutorial. Each is proven safe by what the cells before it reveal. Flags aren't
+// needed to win, so mines are left out. It's an error if the board can't be solved by logic.
+func (g *game) SolutionPath() ([]CellName, error) {
+	path, solved := g.solve()
+	if !solved {
+		return nil, fmt.Errorf("Board can't be solved without guessing.")
+	}
+
+	return path, nil
+}
@@ -0,0 +1,303 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAutoPlayStep(t *testing.T) {
+	g, _ := NewGame(5, 5, 5)
+	event := g.events[0].(gameStartedEvent)
+	event.grid = makeExampleGrid()
+	g.events[0] = event
+	event.applyTo(g)
+
+	// Nothing can be deduced before the first reveal.
+	progressed, err := g.AutoPlayStep()
+	if err != nil || progressed {
+		t.Errorf("Expected no progress before any reveal (progressed: %t, err: %v)", progressed, err)
+	}
+
+	// Open up the board, then let the solver finish it off.
+	g.RevealCell("E3")
+	for steps := 0; !g.isEnded; steps++ {
+		if steps > 50 {
+			t.Fatal("Auto-play failed to finish the game")
+		}
+
+		progressed, err = g.AutoPlayStep()
+		if err != nil {
+			t.Fatalf("Unexpected error during auto-play: %s", err)
+		}
+		if !progressed {
+			t.Fatal("Auto-play stalled on a board which doesn't require guessing")
+		}
+	}
+
+	switch v := g.events[len(g.events)-1].(type) {
+	case gameWonEvent:
+		// Good!
+	default:
+		t.Errorf("Game's last event should be a gameWonEvent (is %T)", v)
+	}
+
+	// Every mine should have been flagged rather than stepped on.
+	g.forEachCell(func(c coordinate, target *cell) {
+		if target.isMined && target.isRevealed {
+			t.Errorf("Auto-play revealed a mine at %s", c)
+		}
+	})
+
+	// There's nothing left to do once the game is won.
+	progressed, _ = g.AutoPlayStep()
+	if progressed {
+		t.Error("Expected no progress after the game is won")
+	}
+}
+
+func TestFlagAllKnownMines(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.RevealCell("C1")
+
+	// B2, B4 and E5 can be proven to be mines, but D1 and A4 can't yet. E5 is flagged already.
+	g.FlagCell("E5")
+	flagged := g.FlagAllKnownMines()
+	if len(flagged) != 2 || flagged[0] != "B2" || flagged[1] != "B4" {
+		t.Errorf("Expected B2 and B4 to be flagged (found %v)", flagged)
+	}
+
+	for _, cellName := range []CellName{"D1", "A4"} {
+		c, _ := cellNameToCoordinate(cellName)
+		if g.grid[c[1]][c[0]].isFlagged {
+			t.Errorf("%s shouldn't be flagged, as it can't be proven to be a mine yet", cellName)
+		}
+	}
+
+	if g.flagCount != 3 {
+		t.Errorf("Expected 3 flags in total (found %d)", g.flagCount)
+	}
+
+	// Running it again has nothing more to do.
+	if flagged = g.FlagAllKnownMines(); len(flagged) != 0 {
+		t.Errorf("Expected nothing more to flag (found %v)", flagged)
+	}
+}
+
+func TestRequiresGuessing(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	if g.RequiresGuessing() {
+		t.Error("Expected the example board to be solvable without guessing")
+	}
+
+	if len(g.events) != 1 || g.revealedSafeCount != 0 {
+		t.Error("Checking the board shouldn't change the game")
+	}
+
+	// Once the right hand side opens up, there's no telling whether the mine is at A1 or A2:
+	// X  1  .  .
+	// 1  1  .  .
+	g, _ = NewGameFromLayout([]CellName{"A1"}, 4, 2)
+	if !g.RequiresGuessing() {
+		t.Error("Expected a 50/50 between A1 and A2 to need guessing")
+	}
+
+	// Most seeded boards this dense are hopeless.
+	dense := 0
+	for seed := int64(1); seed <= 10; seed++ {
+		g, _ = NewGameWithOptions(8, 8, 30, Options{Seed: seed})
+		if g.RequiresGuessing() {
+			dense++
+		}
+	}
+	if dense < 8 {
+		t.Errorf("Expected most dense boards to need guessing (only %d of 10 did)", dense)
+	}
+}
+
+func TestSolutionPath(t *testing.T) {
+	g, _ := NewGameWithOptions(9, 9, 10, Options{Seed: 2})
+	path, err := g.SolutionPath()
+	if err != nil {
+		t.Fatalf("Expected a solution for a board which doesn't need guessing: %s", err)
+	}
+
+	// Following the path should win without a single mine going off.
+	for _, cellName := range path {
+		if err := g.RevealCell(cellName); err != nil {
+			t.Fatalf("Failed revealing %s from the solution: %s", cellName, err)
+		}
+	}
+
+	if _, won := g.events[len(g.events)-1].(gameWonEvent); !won {
+		t.Errorf("Expected following the solution to win the game (last event is %T)", g.events[len(g.events)-1])
+	}
+
+	g, _ = NewGameFromLayout([]CellName{"A1"}, 4, 2)
+	if _, err := g.SolutionPath(); err == nil {
+		t.Error("Expected an error for a board which needs guessing")
+	}
+}
+
+func TestFrontier(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	if frontier := g.Frontier(); len(frontier) != 0 {
+		t.Errorf("Expected no frontier before any reveal (found %v)", frontier)
+	}
+
+	// Revealing E3 opens up columns C to E of rows 2 to 4. Flagged cells are left out.
+	g.RevealCell("E3")
+	g.FlagCell("E5")
+
+	expected := "[B1 C1 D1 E1 B2 B3 B4 B5 C5 D5]"
+	if frontier := fmt.Sprint(g.Frontier()); frontier != expected {
+		t.Errorf("Expected frontier %s (found %s)", expected, frontier)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.FlagCell("E5")
+
+	// C2 has 2 mines among B1, C1, D1, B2 and B3. D4 has 1, but E5 is flagged, so there are none
+	// among C5 and D5.
+	constraints := g.Constraints()
+	if len(constraints) != 7 {
+		t.Fatalf("Expected a constraint from each of the 7 numbers with unrevealed neighbors (found %v)", constraints)
+	}
+
+	if c := fmt.Sprint(constraints[0]); c != "{[B1 C1 D1 B2 B3] 2}" {
+		t.Errorf("Expected C2's constraint to be 2 mines among B1 C1 D1 B2 B3 (found %s)", c)
+	}
+
+	if c := fmt.Sprint(constraints[5]); c != "{[C5 D5] 0}" {
+		t.Errorf("Expected D4's constraint to be no mines among C5 D5 (found %s)", c)
+	}
+}
+
+func TestIsStalemate(t *testing.T) {
+	// Once the right hand side opens up, the mine could be at A1 or A2, so it's a 50/50:
+	// X  1  .  .
+	// 1  1  .  .
+	g, _ := NewGameFromLayout([]CellName{"A1"}, 4, 2)
+	g.RevealCell("D1")
+	if !g.IsStalemate() {
+		t.Error("Expected a 50/50 between A1 and A2 to be a stalemate")
+	}
+
+	// The numbers around the opening at E3 prove where some of the mines are.
+	g, _ = NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	if g.IsStalemate() {
+		t.Error("Expected no stalemate when the numbers prove cells safe or mined")
+	}
+
+	g.RevealCell("D1")
+	if g.IsStalemate() {
+		t.Error("Expected no stalemate once the game has ended")
+	}
+}
+
+func TestIsProvablySafeAndMine(t *testing.T) {
+	//    A  B  C  D  E
+	// 1  .  .  2  .  .
+	// 2  .  X  2  1  1
+	// 3  .  .  2  -  -
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	g.RevealCell("C1")
+
+	if !g.IsProvablySafe("B3") || g.IsProvablyMine("B3") {
+		t.Error("Expected B3 to be provably safe")
+	}
+
+	if !g.IsProvablyMine("B2") || g.IsProvablySafe("B2") {
+		t.Error("Expected B2 to be provably mined")
+	}
+
+	// D1 is mined, but the numbers can't tell it apart from E1 yet.
+	for _, cellName := range []CellName{"D1", "E1", "C2", "Z9"} {
+		if g.IsProvablySafe(cellName) || g.IsProvablyMine(cellName) {
+			t.Errorf("Expected nothing to be proven about %s", cellName)
+		}
+	}
+}
+
+func TestAutoPlayStepSource(t *testing.T) {
+	g, _ := NewGameFromLayout([]CellName{"D1", "B2", "A4", "B4", "E5"}, 5, 5)
+	g.RevealCell("E3")
+	if e, ok := g.events[1].(cellRevealedEvent); !ok || e.Source != SourceUser {
+		t.Errorf("Expected a manual reveal to be tagged %s (found %v)", SourceUser, g.events[1])
+	}
+
+	if e, ok := g.events[2].(cellRevealedEvent); !ok || e.Source != SourceCascade {
+		t.Errorf("Expected a cascade to be tagged %s (found %v)", SourceCascade, g.events[2])
+	}
+
+	g.AutoPlayStep()
+	if e, ok := g.events[len(g.events)-1].(cellRevealedEvent); !ok || e.Source != SourceAI {
+		t.Errorf("Expected an AutoPlayStep reveal to be tagged %s (found %v)", SourceAI, g.events[len(g.events)-1])
+	}
+
+	// The source is kept through a save.
+	saved := saveEvent(g.events[len(g.events)-1])
+	if loaded, _, err := loadEvent(saved, g.grid, Moore); err != nil || loaded.(cellRevealedEvent).Source != SourceAI {
+		t.Errorf("Expected the source to be loaded back (found %v, %v)", loaded, err)
+	}
+
+	// Moves after it are the player's again.
+	g.FlagCell("A1")
+	if e := g.events[len(g.events)-1].(cellFlaggedEvent); e.Source != SourceUser {
+		t.Errorf("Expected a manual flag to be tagged %s (found %s)", SourceUser, e.Source)
+	}
+}
+
+func TestMinMinesRemaining(t *testing.T) {
+	// A1 and C1 each see one mine, but could both be seeing the same one at B2:
+	// 1  .  1
+	// .  .  .
+	g, _ := NewGameFromLayout([]CellName{"B2"}, 3, 2)
+	g.RevealCell("A1")
+	g.RevealCell("C1")
+
+	sum := 0
+	for _, c := range g.Constraints() {
+		sum += c.Mines
+	}
+
+	if min := g.MinMinesRemaining(); min != 1 || sum != 2 {
+		t.Errorf("Expected at least 1 mine, rather than the 2 the numbers add up to (found %d and %d)", min, sum)
+	}
+
+	// Flagging the mine accounts for it.
+	g.FlagCell("B2")
+	if min := g.MinMinesRemaining(); min != 0 {
+		t.Errorf("Expected no more mines once B2 is flagged (found %d)", min)
+	}
+}
+
+func TestRevealSafest(t *testing.T) {
+	// D2 sees one mine among its eight neighbors, which is less likely than the three left
+	// among the eleven cells elsewhere, so it's best to guess next to it.
+	g, _ := NewGameFromLayout([]CellName{"A1", "A2", "A4", "C3"}, 5, 4)
+	g.RevealCell("D2")
+	if !g.IsStalemate() {
+		t.Fatal("Expected a guess to be needed after revealing D2")
+	}
+
+	probabilities := g.MineProbabilities()
+	if p := probabilities["C1"]; p != 0.125 || probabilities["A3"] != 3.0/11 {
+		t.Errorf("Expected 1/8 for C1 and 3/11 for A3 (found %v and %v)", p, probabilities["A3"])
+	}
+
+	before := len(g.events)
+	cellName, err := g.RevealSafest()
+	if err != nil || cellName != "C1" {
+		t.Errorf("Expected the first of the least likely cells, C1, to be revealed (found %s, error %v)", cellName, err)
+	}
+
+	if e, ok := g.events[before].(cellRevealedEvent); !ok || e.Source != SourceAI {
+		t.Errorf("Expected the reveal to be tagged %s (found %v)", SourceAI, g.events[before])
+	}
+}
@@ -0,0 +1,56 @@
+package game
+
+import "time"
+
+// PlayerStats sums up the outcomes of many games, e.g. for a profile screen.
+type PlayerStats struct {
+	Games  int
+	Wins   int
+	Losses int
+
+	// WinRate is the fraction of finished games which were won.
+	WinRate float64
+
+	// BestWinTime is how long the quickest win took, from the start of the game. It's zero
+	// until there's a win.
+	BestWinTime time.Duration
+}
+
+// Add counts a game towards the stats. Games still being played only count towards Games.
+func (s *PlayerStats) Add(g *game) {
+	s.Games++
+	if !g.isEnded {
+		return
+	}
+
+	if !g.isWon {
+		s.Losses++
+	} else {
+		s.Wins++
+
+		// Notes can still be made after the win, so time it by the win itself rather than the
+		// last event.
+		for _, e := range g.events {
+			if won, ok := e.(gameWonEvent); ok {
+				if took := won.At.Sub(g.createdAt); s.BestWinTime == 0 || took < s.BestWinTime {
+					s.BestWinTime = took
+				}
+			}
+		}
+	}
+
+	s.WinRate = float64(s.Wins) / float64(s.Wins+s.Losses)
+}
+
+// SavedGameStats gathers stats over every game in SaveDir. Games which can't be loaded are
+// left out.
+func SavedGameStats() PlayerStats {
+	stats := PlayerStats{}
+	for _, info := range ListSavedGames() {
+		if g, err := LoadGame(info.Id); err == nil {
+			stats.Add(g)
+		}
+	}
+
+	return stats
+}
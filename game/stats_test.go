@@ -0,0 +1,52 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSavedGameStats(t *testing.T) {
+	useTempSaveDir(t)
+	useFakeClock(t, time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), time.Second)
+
+	// A win in one move, a win in four, a loss, and a game still going.
+	quick, _ := NewGameFromLayout([]CellName{"A1", "B1", "A2"}, 2, 2)
+	quick.RevealCell("B2")
+
+	slow, _ := NewGameFromLayout([]CellName{"A1"}, 3, 2)
+	slow.FlagCell("A1")
+	slow.FlagCell("A1")
+	slow.RevealCell("C2")
+	slow.RevealCell("A2")
+
+	lost, _ := NewGameFromLayout([]CellName{"A1"}, 3, 2)
+	lost.RevealCell("A1")
+
+	playing, _ := NewGameFromLayout([]CellName{"A1"}, 3, 2)
+	playing.FlagCell("A1")
+
+	// A note the next day doesn't make the quick win any slower.
+	useFakeClock(t, time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC), time.Second)
+	if err := quick.AnnotateCell("A1", "knew it"); err != nil {
+		t.Fatalf("Failed annotating finished game: %s", err)
+	}
+
+	for _, g := range []*game{quick, slow, lost, playing} {
+		if err := g.Save(); err != nil {
+			t.Fatalf("Failed saving game: %s", err)
+		}
+	}
+
+	expected := PlayerStats{
+		Games:   4,
+		Wins:    2,
+		Losses:  1,
+		WinRate: 2.0 / 3.0,
+
+		// The reveal and win are a second apart, each a second after the start.
+		BestWinTime: 2 * time.Second,
+	}
+	if stats := SavedGameStats(); stats != expected {
+		t.Errorf("Expected stats %+v (found %+v)", expected, stats)
+	}
+}
@@ -0,0 +1,163 @@
+// Package httpapi makes games playable over a small JSON API.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"zephyri.co/mineswept/eventsource"
+	"zephyri.co/mineswept/game"
+)
+
+// Server handles the following routes, responding with the game's snapshot on success:
+//
+//	POST /games               {"width": 10, "height": 10, "mines": 10}
+//	GET  /games/{id}
+//	POST /games/{id}/reveal   {"cell": "B6"}
+//	POST /games/{id}/flag     {"cell": "B6"}
+//
+// Games are only kept in memory, with every event each move adds appended to Store as well.
+type Server struct {
+	Store *eventsource.InMemoryStore
+
+	mu    sync.Mutex
+	games map[string]game.Game
+}
+
+func NewServer() *Server {
+	return &Server{Store: eventsource.NewInMemoryStore(), games: make(map[string]game.Game)}
+}
+
+type newGameRequest struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Mines  int `json:"mines"`
+}
+
+type moveRequest struct {
+	Cell game.CellName `json:"cell"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Split e.g. /games/{id}/reveal into ["games", "{id}", "reveal"].
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "games" {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.createGame(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.getGame(w, parts[1])
+	case len(parts) == 3 && parts[2] == "reveal" && r.Method == http.MethodPost:
+		s.move(w, r, parts[1], game.Game.RevealCell)
+	case len(parts) == 3 && parts[2] == "flag" && r.Method == http.MethodPost:
+		s.move(w, r, parts[1], game.Game.FlagCell)
+	case len(parts) <= 3:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed.", r.Method))
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+func (s *Server) createGame(w http.ResponseWriter, r *http.Request) {
+	var req newGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
+		return
+	}
+
+	g, err := game.NewGame(req.Width, req.Height, req.Mines)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.storeEvents(g, 0); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	snapshot := g.Snapshot()
+	s.games[snapshot.Id] = g
+	writeJSON(w, http.StatusCreated, snapshot)
+}
+
+func (s *Server) getGame(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No game with id %s.", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, g.Snapshot())
+}
+
+func (s *Server) move(w http.ResponseWriter, r *http.Request, id string, play func(game.Game, game.CellName) error) {
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request body: %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.games[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("No game with id %s.", id))
+		return
+	}
+
+	version := g.Snapshot().Version
+	if err := play(g, req.Cell); errors.Is(err, game.ErrInternal) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.storeEvents(g, version); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, g.Snapshot())
+}
+
+// storeEvents appends the game's events after the given version to the store.
+func (s *Server) storeEvents(g game.Game, since int) error {
+	events := []eventsource.Event{}
+	for _, r := range g.Records(since) {
+		events = append(events, r)
+	}
+
+	return s.Store.Append(events...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zephyri.co/mineswept/game"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	// Create a game.
+	var created game.Snapshot
+	status := doRequest(t, http.MethodPost, s.URL+"/games", `{"width": 8, "height": 8, "mines": 10}`, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status %d creating a game (got %d)", http.StatusCreated, status)
+	}
+
+	if created.Width != 8 || created.Height != 8 || created.MinesRemaining != 10 {
+		t.Errorf("Created game has the wrong size or mine count: %dx%d, %d mines", created.Width, created.Height, created.MinesRemaining)
+	}
+
+	// Reveal a cell.
+	var revealed game.Snapshot
+	status = doRequest(t, http.MethodPost, s.URL+"/games/"+created.Id+"/reveal", `{"cell": "A1"}`, &revealed)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d revealing a cell (got %d)", http.StatusOK, status)
+	}
+
+	if !revealed.Cells[0][0].IsRevealed {
+		t.Error("Failed to reveal cell A1")
+	}
+
+	if revealed.Version <= created.Version {
+		t.Errorf("Game version should increase after a reveal (went from %d to %d)", created.Version, revealed.Version)
+	}
+
+	// Fetching the game gives the same state back.
+	var fetched game.Snapshot
+	status = doRequest(t, http.MethodGet, s.URL+"/games/"+created.Id, "", &fetched)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d fetching a game (got %d)", http.StatusOK, status)
+	}
+
+	if fetched.Version != revealed.Version || !fetched.Cells[0][0].IsRevealed {
+		t.Errorf("Fetched game doesn't match the last move (version %d, expected %d)", fetched.Version, revealed.Version)
+	}
+
+	// Invalid moves and unknown games are rejected with an error message.
+	var failed errorResponse
+	status = doRequest(t, http.MethodPost, s.URL+"/games/"+created.Id+"/flag", `{"cell": "Z99"}`, &failed)
+	if status != http.StatusBadRequest || failed.Error == "" {
+		t.Errorf("Expected status %d and a message flagging an invalid cell (got %d, %q)", http.StatusBadRequest, status, failed.Error)
+	}
+
+	status = doRequest(t, http.MethodGet, s.URL+"/games/nope", "", &failed)
+	if status != http.StatusNotFound {
+		t.Errorf("Expected status %d fetching an unknown game (got %d)", http.StatusNotFound, status)
+	}
+
+	// Every event up to the last move has been stored.
+	if latest, err := server.Store.LatestVersion(created.Id); err != nil || latest != revealed.Version {
+		t.Errorf("Expected the store to have events up to version %d (found %d, error %v)", revealed.Version, latest, err)
+	}
+}
+
+// brokenGame fails every move with a bug of its own.
+type brokenGame struct {
+	game.Game
+}
+
+func (g brokenGame) RevealCell(cellName game.CellName) error {
+	return fmt.Errorf("%w The move was abandoned: broken", game.ErrInternal)
+}
+
+func (g brokenGame) Snapshot() game.Snapshot {
+	return game.Snapshot{Id: "broken", Version: 1}
+}
+
+func TestServerInternalError(t *testing.T) {
+	server := NewServer()
+	server.games["broken"] = brokenGame{}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	// A bug in the game isn't the client's fault.
+	var failed errorResponse
+	status := doRequest(t, http.MethodPost, s.URL+"/games/broken/reveal", `{"cell": "A1"}`, &failed)
+	if status != http.StatusInternalServerError || failed.Error == "" {
+		t.Errorf("Expected status %d and a message for an internal error (got %d, %q)", http.StatusInternalServerError, status, failed.Error)
+	}
+}
+
+func doRequest(t *testing.T, method, url, body string, result interface{}) int {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request to %s failed: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		t.Fatalf("Failed to decode response from %s: %s", url, err)
+	}
+
+	return resp.StatusCode
+}